@@ -0,0 +1,349 @@
+// Package config は環境変数からアプリケーションの設定を読み込む
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/bytes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultSessionSecret は開発環境で SESSION_SECRET が設定されていないときに使うセッションの鍵
+const defaultSessionSecret = "secret-token"
+
+type Config struct {
+	// Production は APP_ENV が production のときにtrueになる
+	Production bool
+	// LogLevel はslogのログレベル (LOG_LEVEL)
+	LogLevel slog.Level
+
+	// データベースの接続先 (DB_USERNAME, DB_PASSWORD, DB_HOSTNAME, DB_PORT, DB_DATABASE)
+	DBUser     string
+	DBPassword string
+	DBHost     string
+	DBPort     string
+	DBName     string
+	// DBMaxOpenConns, DBMaxIdleConns, DBConnMaxLifetime はコネクションプールの設定
+	// (DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME)
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	// DBCreateIndexes がtrueなら、起動時に検索で使うカラムにインデックスを作成する (DB_CREATE_INDEXES)
+	DBCreateIndexes bool
+	// SchemaCheckStrict がtrueなら、テーブルと構造体が食い違っているときに起動を中止する (SCHEMA_CHECK_STRICT)
+	SchemaCheckStrict bool
+
+	// SessionSecret はセッションのCookieの署名に使う鍵 (SESSION_SECRET)
+	// 本番環境では必須
+	SessionSecret string
+	// TokenSecret は /me/token が発行するJWTの署名に使う鍵 (TOKEN_SECRET)
+	// 空なら /me/token を公開しない
+	TokenSecret string
+	// BcryptCost はパスワードをハッシュ化するときのコスト (BCRYPT_COST)
+	BcryptCost int
+	// LoginMaxFailures と LoginFailureWindow はログイン失敗の制限 (LOGIN_MAX_FAILURES, LOGIN_FAILURE_WINDOW)
+	// 0ならハンドラーのデフォルト値を使う
+	LoginMaxFailures   int
+	LoginFailureWindow time.Duration
+	// LoginRedirectAllowlist はフォームからのログイン後にリダイレクトしてよいパス (LOGIN_REDIRECT_ALLOWLIST)
+	LoginRedirectAllowlist []string
+
+	// UniqueCityPerDistrict がtrueなら、同じ国・地区に同名の都市を登録できなくする (UNIQUE_CITY_PER_DISTRICT)
+	UniqueCityPerDistrict bool
+	// AnomalyThreshold は人口の異常値とみなす標準偏差の倍数 (ANOMALY_THRESHOLD)
+	// 0ならハンドラーのデフォルト値を使う
+	AnomalyThreshold float64
+
+	// AccessLogFile が空でなければ、アクセスログをこのファイルにも書き込む (ACCESS_LOG_FILE)
+	AccessLogFile string
+	// AccessLogMaxSize はアクセスログのファイルをローテーションするサイズ (バイト、ACCESS_LOG_MAX_SIZE)
+	AccessLogMaxSize int64
+	// AccessLogMaxBackups はローテーションしたアクセスログを新しいものからいくつ残すか (ACCESS_LOG_MAX_BACKUPS)
+	// 0なら全て残す
+	AccessLogMaxBackups int
+	// BodyLimit はリクエストボディの最大サイズ (バイト、BODY_LIMIT に "1M" のような形式で指定する)
+	BodyLimit int64
+	// TrustedProxies はX-Forwarded-Forを信頼するリバースプロキシのIPアドレスの範囲 (TRUSTED_PROXIES、カンマ区切りのCIDR)
+	// 空ならX-Forwarded-Forを無視し、接続元のIPアドレスをクライアントのIPアドレスとする
+	TrustedProxies []*net.IPNet
+	// CORSAllowedOrigins はクロスオリジンのリクエストを許可するオリジン (CORS_ALLOWED_ORIGINS)
+	// 空なら全て拒否する
+	CORSAllowedOrigins []string
+	// CompressAlgorithms と CompressMinLength はレスポンスの圧縮方式と圧縮する最小バイト数
+	// (COMPRESS_ALGORITHMS, COMPRESS_MIN_LENGTH)
+	CompressAlgorithms []string
+	CompressMinLength  int
+	// RequestTimeout と RequestTimeoutOverrides は全体とルートごとのリクエストのタイムアウト
+	// (REQUEST_TIMEOUT, REQUEST_TIMEOUT_OVERRIDES)
+	RequestTimeout          time.Duration
+	RequestTimeoutOverrides map[string]time.Duration
+	// ResponseEnvelope がtrueなら、成功レスポンスを {"data": ..., "meta": ...} で包む (RESPONSE_ENVELOPE)
+	ResponseEnvelope bool
+	// StrictInputCheck がtrueなら、SQLのような文字列を含むパラメータを拒否する (STRICT_INPUT_CHECK)
+	StrictInputCheck bool
+
+	// TLSAutocertDomains はLet's Encryptで証明書を取得するドメイン (TLS_AUTOCERT_DOMAINS)
+	// 空ならHTTPで待ち受ける
+	TLSAutocertDomains []string
+	// TLSAutocertCacheDir は取得した証明書を保存するディレクトリ (TLS_AUTOCERT_CACHE_DIR)
+	TLSAutocertCacheDir string
+	// TLSMinVersion はTLSの最小バージョン (TLS_MIN_VERSION、"1.2" か "1.3")
+	TLSMinVersion uint16
+	// TLSCipherSuites はTLS 1.2で使う暗号スイート (TLS_CIPHER_SUITES、カンマ区切りの暗号スイート名)
+	TLSCipherSuites []uint16
+}
+
+// LoadConfig は環境変数から設定を読み込む
+// 設定されていない項目にはデフォルト値を使い、不正な値があればエラーを返す
+func LoadConfig() (Config, error) {
+	return load(os.Getenv)
+}
+
+// load は getenv から設定を読み込む。テストでは環境変数の代わりにmapを渡す
+func load(getenv func(string) string) (Config, error) {
+	l := loader{getenv: getenv}
+	cfg := Config{
+		Production: l.getenv("APP_ENV") == "production",
+
+		DBUser:            l.getenv("DB_USERNAME"),
+		DBPassword:        l.getenv("DB_PASSWORD"),
+		DBHost:            l.getenv("DB_HOSTNAME"),
+		DBPort:            l.getenv("DB_PORT"),
+		DBName:            l.getenv("DB_DATABASE"),
+		DBMaxOpenConns:    l.int("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:    l.int("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetime: l.duration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		DBCreateIndexes:   l.getenv("DB_CREATE_INDEXES") == "true",
+		SchemaCheckStrict: l.getenv("SCHEMA_CHECK_STRICT") == "true",
+
+		SessionSecret:          l.getenv("SESSION_SECRET"),
+		TokenSecret:            l.getenv("TOKEN_SECRET"),
+		BcryptCost:             l.int("BCRYPT_COST", bcrypt.DefaultCost),
+		LoginMaxFailures:       l.int("LOGIN_MAX_FAILURES", 0),
+		LoginFailureWindow:     l.duration("LOGIN_FAILURE_WINDOW", 0),
+		LoginRedirectAllowlist: l.list("LOGIN_REDIRECT_ALLOWLIST", nil),
+
+		UniqueCityPerDistrict: l.getenv("UNIQUE_CITY_PER_DISTRICT") == "true",
+		AnomalyThreshold:      l.float("ANOMALY_THRESHOLD", 0),
+
+		AccessLogFile:           l.getenv("ACCESS_LOG_FILE"),
+		AccessLogMaxSize:        int64(l.int("ACCESS_LOG_MAX_SIZE", 10*1024*1024)),
+		AccessLogMaxBackups:     l.int("ACCESS_LOG_MAX_BACKUPS", 5),
+		BodyLimit:               l.byteSize("BODY_LIMIT", "1M"),
+		TrustedProxies:          l.cidrs("TRUSTED_PROXIES"),
+		CORSAllowedOrigins:      l.list("CORS_ALLOWED_ORIGINS", nil),
+		CompressAlgorithms:      l.list("COMPRESS_ALGORITHMS", []string{"br", "gzip"}),
+		CompressMinLength:       l.int("COMPRESS_MIN_LENGTH", 1024),
+		RequestTimeout:          l.duration("REQUEST_TIMEOUT", 30*time.Second),
+		RequestTimeoutOverrides: l.timeoutOverrides("REQUEST_TIMEOUT_OVERRIDES"),
+		ResponseEnvelope:        l.getenv("RESPONSE_ENVELOPE") == "true",
+		StrictInputCheck:        l.getenv("STRICT_INPUT_CHECK") == "true",
+
+		TLSAutocertDomains:  l.list("TLS_AUTOCERT_DOMAINS", nil),
+		TLSAutocertCacheDir: l.str("TLS_AUTOCERT_CACHE_DIR", "certs"),
+		TLSMinVersion:       l.tlsVersion("TLS_MIN_VERSION", tls.VersionTLS12),
+		TLSCipherSuites:     l.cipherSuites("TLS_CIPHER_SUITES", defaultCipherSuites),
+	}
+	if l.err != nil {
+		return Config{}, l.err
+	}
+
+	// LOG_LEVELが不正な値ならinfoにする
+	err := cfg.LogLevel.UnmarshalText([]byte(l.getenv("LOG_LEVEL")))
+	if err != nil {
+		cfg.LogLevel = slog.LevelInfo
+	}
+
+	if cfg.SessionSecret == "" {
+		if cfg.Production {
+			return Config{}, errors.New("SESSION_SECRET must be set in production")
+		}
+		cfg.SessionSecret = defaultSessionSecret
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return Config{}, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return cfg, nil
+}
+
+// loader は環境変数を読み込み、最初に見つかった不正な値のエラーを err に残す
+type loader struct {
+	getenv func(string) string
+	err    error
+}
+
+func (l *loader) fail(name string, err error) {
+	if l.err == nil {
+		l.err = fmt.Errorf("invalid %s: %w", name, err)
+	}
+}
+
+func (l *loader) int(name string, def int) int {
+	v := l.getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		l.fail(name, err)
+	}
+	return n
+}
+
+func (l *loader) float(name string, def float64) float64 {
+	v := l.getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		l.fail(name, err)
+	}
+	return f
+}
+
+func (l *loader) duration(name string, def time.Duration) time.Duration {
+	v := l.getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		l.fail(name, err)
+	}
+	return d
+}
+
+// timeoutOverrides は "/cities/export=2m,/admin/scenario=1m" の形式の文字列を
+// ルートのパターンからタイムアウトへのmapにする
+func (l *loader) timeoutOverrides(name string) map[string]time.Duration {
+	overrides := map[string]time.Duration{}
+	for _, entry := range strings.Split(l.getenv(name), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			l.fail(name, fmt.Errorf("%q has no timeout", entry))
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			l.fail(name, err)
+			continue
+		}
+		overrides[path] = timeout
+	}
+	return overrides
+}
+
+// str は環境変数を読み込み、設定されていなければ def を返す
+func (l *loader) str(name string, def string) string {
+	v := l.getenv(name)
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// byteSize は "1M" や "512K" のような大きさの環境変数をバイト数として読み込む
+func (l *loader) byteSize(name string, def string) int64 {
+	n, err := bytes.Parse(l.str(name, def))
+	if err != nil {
+		l.fail(name, err)
+	}
+	return n
+}
+
+// list はカンマ区切りの環境変数を読み込む
+// 各要素の前後の空白を取り除き、空の要素は無視する。要素が1つもなければ def を返す
+func (l *loader) list(name string, def []string) []string {
+	values := []string{}
+	for _, v := range strings.Split(l.getenv(name), ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return def
+	}
+	return values
+}
+
+// cidrs はカンマ区切りのCIDR (例: 10.0.0.0/8) を読み込む
+func (l *loader) cidrs(name string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, v := range l.list(name, nil) {
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			l.fail(name, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// defaultCipherSuites は前方秘匿性のあるAEADの暗号スイート (TLS 1.2用)
+// TLS 1.3の暗号スイートはGoが自動で選ぶので設定できない
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// tlsVersion は "1.2" か "1.3" の環境変数を読み込む
+func (l *loader) tlsVersion(name string, def uint16) uint16 {
+	v := l.getenv(name)
+	if v == "" {
+		return def
+	}
+	version, ok := tlsVersions[v]
+	if !ok {
+		l.fail(name, fmt.Errorf("unsupported TLS version %q", v))
+	}
+	return version
+}
+
+// cipherSuites はカンマ区切りの暗号スイート名を読み込む
+// 安全でないとされている暗号スイート (tls.InsecureCipherSuites) は受け付けない
+func (l *loader) cipherSuites(name string, def []uint16) []uint16 {
+	names := l.list(name, nil)
+	if len(names) == 0 {
+		return def
+	}
+
+	ids := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+	suites := []uint16{}
+	for _, suiteName := range names {
+		id, ok := ids[suiteName]
+		if !ok {
+			l.fail(name, fmt.Errorf("unsupported cipher suite %q", suiteName))
+			continue
+		}
+		suites = append(suites, id)
+	}
+	return suites
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeGetenv は m を環境変数として返す getenv を作る
+func fakeGetenv(m map[string]string) func(string) string {
+	return func(name string) string {
+		return m[name]
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(fakeGetenv(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		LogLevel:                slog.LevelInfo,
+		DBMaxOpenConns:          25,
+		DBMaxIdleConns:          5,
+		DBConnMaxLifetime:       5 * time.Minute,
+		SessionSecret:           defaultSessionSecret,
+		BcryptCost:              bcrypt.DefaultCost,
+		AccessLogMaxSize:        10 * 1024 * 1024,
+		AccessLogMaxBackups:     5,
+		BodyLimit:               1000 * 1000,
+		CompressAlgorithms:      []string{"br", "gzip"},
+		CompressMinLength:       1024,
+		RequestTimeout:          30 * time.Second,
+		RequestTimeoutOverrides: map[string]time.Duration{},
+		TLSAutocertCacheDir:     "certs",
+		TLSMinVersion:           tls.VersionTLS12,
+		TLSCipherSuites:         defaultCipherSuites,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("load() =\n%+v\nwant\n%+v", cfg, want)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	cfg, err := load(fakeGetenv(map[string]string{
+		"APP_ENV":                   "production",
+		"LOG_LEVEL":                 "debug",
+		"DB_MAX_OPEN_CONNS":         "50",
+		"DB_CONN_MAX_LIFETIME":      "1m",
+		"DB_CREATE_INDEXES":         "true",
+		"SESSION_SECRET":            "s3cret",
+		"BCRYPT_COST":               "12",
+		"ANOMALY_THRESHOLD":         "2.5",
+		"BODY_LIMIT":                "2M",
+		"CORS_ALLOWED_ORIGINS":      "https://a.example.com, https://b.example.com,",
+		"COMPRESS_ALGORITHMS":       "gzip",
+		"REQUEST_TIMEOUT":           "10s",
+		"REQUEST_TIMEOUT_OVERRIDES": "/cities/export=2m, /admin/scenario=1m",
+		"TLS_AUTOCERT_DOMAINS":      "example.com",
+		"TLS_AUTOCERT_CACHE_DIR":    "/var/lib/certs",
+		"TLS_MIN_VERSION":           "1.3",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"Production", cfg.Production, true},
+		{"LogLevel", cfg.LogLevel, slog.LevelDebug},
+		{"DBMaxOpenConns", cfg.DBMaxOpenConns, 50},
+		{"DBConnMaxLifetime", cfg.DBConnMaxLifetime, time.Minute},
+		{"DBCreateIndexes", cfg.DBCreateIndexes, true},
+		{"SessionSecret", cfg.SessionSecret, "s3cret"},
+		{"BcryptCost", cfg.BcryptCost, 12},
+		{"AnomalyThreshold", cfg.AnomalyThreshold, 2.5},
+		{"BodyLimit", cfg.BodyLimit, int64(2 * 1000 * 1000)},
+		{"CORSAllowedOrigins", cfg.CORSAllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}},
+		{"CompressAlgorithms", cfg.CompressAlgorithms, []string{"gzip"}},
+		{"RequestTimeout", cfg.RequestTimeout, 10 * time.Second},
+		{"RequestTimeoutOverrides", cfg.RequestTimeoutOverrides, map[string]time.Duration{"/cities/export": 2 * time.Minute, "/admin/scenario": time.Minute}},
+		{"TLSAutocertDomains", cfg.TLSAutocertDomains, []string{"example.com"}},
+		{"TLSAutocertCacheDir", cfg.TLSAutocertCacheDir, "/var/lib/certs"},
+		{"TLSMinVersion", cfg.TLSMinVersion, uint16(tls.VersionTLS13)},
+	}
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("%s = %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "non-numeric int", env: map[string]string{"DB_MAX_OPEN_CONNS": "many"}},
+		{name: "invalid duration", env: map[string]string{"DB_CONN_MAX_LIFETIME": "5"}},
+		{name: "invalid float", env: map[string]string{"ANOMALY_THRESHOLD": "high"}},
+		{name: "timeout override without value", env: map[string]string{"REQUEST_TIMEOUT_OVERRIDES": "/cities/export"}},
+		{name: "timeout override with invalid duration", env: map[string]string{"REQUEST_TIMEOUT_OVERRIDES": "/cities/export=soon"}},
+		{name: "bcrypt cost too low", env: map[string]string{"BCRYPT_COST": "1"}},
+		{name: "bcrypt cost too high", env: map[string]string{"BCRYPT_COST": "100"}},
+		{name: "production without session secret", env: map[string]string{"APP_ENV": "production"}},
+		{name: "malformed body limit", env: map[string]string{"BODY_LIMIT": "lots"}},
+		{name: "body limit with unknown unit", env: map[string]string{"BODY_LIMIT": "1X"}},
+		{name: "invalid trusted proxy", env: map[string]string{"TRUSTED_PROXIES": "10.0.0.1"}},
+		{name: "unsupported TLS version", env: map[string]string{"TLS_MIN_VERSION": "1.0"}},
+		{name: "malformed TLS version", env: map[string]string{"TLS_MIN_VERSION": "tls12"}},
+		{name: "unknown cipher suite", env: map[string]string{"TLS_CIPHER_SUITES": "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_UNKNOWN"}},
+		{name: "insecure cipher suite", env: map[string]string{"TLS_CIPHER_SUITES": "TLS_RSA_WITH_RC4_128_SHA"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(fakeGetenv(tt.env))
+			if err == nil {
+				t.Fatal("load() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoadInvalidLogLevelFallsBackToInfo(t *testing.T) {
+	cfg, err := load(fakeGetenv(map[string]string{"LOG_LEVEL": "verbose"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != slog.LevelInfo {
+		t.Fatalf("LogLevel = %v, want %v", cfg.LogLevel, slog.LevelInfo)
+	}
+}
+
+func TestLoadTLSAutocert(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantDomains  []string
+		wantCacheDir string
+	}{
+		{name: "not set", env: map[string]string{}, wantDomains: nil, wantCacheDir: "certs"},
+		{name: "only commas and spaces", env: map[string]string{"TLS_AUTOCERT_DOMAINS": " , ,"}, wantDomains: nil, wantCacheDir: "certs"},
+		{name: "single domain", env: map[string]string{"TLS_AUTOCERT_DOMAINS": "example.com"}, wantDomains: []string{"example.com"}, wantCacheDir: "certs"},
+		{
+			name:         "domains with spaces and empty entries",
+			env:          map[string]string{"TLS_AUTOCERT_DOMAINS": " example.com, ,www.example.com ,"},
+			wantDomains:  []string{"example.com", "www.example.com"},
+			wantCacheDir: "certs",
+		},
+		{
+			name:         "cache dir",
+			env:          map[string]string{"TLS_AUTOCERT_DOMAINS": "example.com", "TLS_AUTOCERT_CACHE_DIR": "/var/lib/certs"},
+			wantDomains:  []string{"example.com"},
+			wantCacheDir: "/var/lib/certs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(fakeGetenv(tt.env))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.TLSAutocertDomains, tt.wantDomains) {
+				t.Errorf("TLSAutocertDomains = %q, want %q", cfg.TLSAutocertDomains, tt.wantDomains)
+			}
+			if cfg.TLSAutocertCacheDir != tt.wantCacheDir {
+				t.Errorf("TLSAutocertCacheDir = %q, want %q", cfg.TLSAutocertCacheDir, tt.wantCacheDir)
+			}
+		})
+	}
+}
+
+func TestLoadTLSCipherSuites(t *testing.T) {
+	cfg, err := load(fakeGetenv(map[string]string{
+		"TLS_CIPHER_SUITES": "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if !reflect.DeepEqual(cfg.TLSCipherSuites, want) {
+		t.Fatalf("TLSCipherSuites = %v, want %v", cfg.TLSCipherSuites, want)
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ScenarioRequestBody struct {
+	Users  []LoginRequestBody `json:"users"`
+	Cities []CityInput        `json:"cities"`
+}
+
+type ScenarioResponse struct {
+	Users  []string `json:"users"`
+	Cities []int    `json:"cities"`
+}
+
+// PostScenarioHandler はデモやテスト用に、ユーザーと都市をまとめて1つのトランザクションで作成する
+// どれか1つでも失敗したら全て取り消す
+func (h *Handler) PostScenarioHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var req ScenarioRequestBody
+	err := c.Bind(&req)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+
+	for i, user := range req.Users {
+		req.Users[i].Username = normalizeUsername(user.Username)
+		if req.Users[i].Username == "" || user.Password == "" {
+			return jsonError(c, http.StatusBadRequest, "Username or Password is empty")
+		}
+		if err := validatePassword(user.Password); err != nil {
+			return jsonError(c, http.StatusBadRequest, err.Error())
+		}
+	}
+	codes := make([]string, 0, len(req.Cities))
+	for _, city := range req.Cities {
+		if err := validateCityInput(city); err != nil {
+			return jsonError(c, http.StatusBadRequest, err.Error())
+		}
+		codes = append(codes, city.CountryCode)
+	}
+
+	countries, err := h.existingCountryCodes(ctx, codes)
+	if err != nil {
+		h.logger(c).Error("failed to check country codes", "error", err)
+		return internalError(c, err)
+	}
+	for _, city := range req.Cities {
+		if !countries[city.CountryCode] {
+			return jsonError(c, http.StatusBadRequest, "countryCode "+city.CountryCode+" does not exist")
+		}
+	}
+
+	// bcrypt は遅いので、トランザクションを始める前にハッシュ化しておく
+	hashedPasses := make([][]byte, len(req.Users))
+	for i, user := range req.Users {
+		hashedPasses[i], err = bcrypt.GenerateFromPassword([]byte(user.Password), h.BcryptCost)
+		if err != nil {
+			h.logger(c).Error("failed to hash password", "error", err)
+			return internalError(c, err)
+		}
+	}
+
+	userName := c.Get("userName").(string)
+	res := ScenarioResponse{Users: []string{}, Cities: []int{}}
+	// 一意制約に違反したユーザー名 (409 Conflictのメッセージに使う)
+	var duplicateUser string
+	err = h.withTx(ctx, func(tx *sqlx.Tx) error {
+		for i, user := range req.Users {
+			_, err := tx.ExecContext(ctx, "INSERT INTO users (Username, HashedPass) VALUES (?, ?)", user.Username, hashedPasses[i])
+			if err != nil {
+				if isDuplicateEntry(err) {
+					duplicateUser = user.Username
+				}
+				return fmt.Errorf("failed to insert scenario user: %w", err)
+			}
+			res.Users = append(res.Users, user.Username)
+		}
+
+		if len(req.Cities) == 0 {
+			return nil
+		}
+		ids, err := insertCities(ctx, tx, req.Cities, userName)
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			req.Cities[i].ID = id
+		}
+		res.Cities = ids
+		return nil
+	})
+	if err != nil {
+		if duplicateUser != "" {
+			return jsonError(c, http.StatusConflict, "Username "+duplicateUser+" is already used")
+		}
+		h.logger(c).Error("failed to create scenario", "error", err)
+		return internalError(c, err)
+	}
+
+	h.auditCities(userName, "create", res.Cities)
+	for _, city := range req.Cities {
+		h.hub.Publish("created", city)
+	}
+
+	return respondJSON(c, http.StatusCreated, res)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPostScenarioHandlerRejectsInvalidInput(t *testing.T) {
+	// DBに触る前に400を返すので、db は nil のままでよい
+	h := &Handler{}
+	e := echo.New()
+	e.POST("/admin/scenario", h.PostScenarioHandler)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "empty password", body: `{"users": [{"username": "alice", "password": ""}]}`},
+		{name: "weak password", body: `{"users": [{"username": "alice", "password": "password"}]}`},
+		{name: "invalid city", body: `{"cities": [{"name": "", "countryCode": "JPN"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/scenario", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostScenarioHandlerRollsBackOnFailure(t *testing.T) {
+	body := `{
+		"users": [{"username": "alice", "password": "password123"}, {"username": "bob", "password": "password123"}],
+		"cities": [{"name": "Tokyo", "countryCode": "JPN", "district": "Tokyo-to", "population": 100}]
+	}`
+
+	tests := []struct {
+		name       string
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "duplicate second user",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO users").WithArgs("alice", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO users").WithArgs("bob", sqlmock.AnyArg()).
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'bob' for key 'PRIMARY'"})
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "city insert fails after users",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO users").WithArgs("alice", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO users").WithArgs("bob", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO city ").WillReturnError(errors.New("disk full"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "population history fails after city",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO users").WithArgs("alice", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO users").WithArgs("bob", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO city ").WillReturnResult(sqlmock.NewResult(10, 1))
+				mock.ExpectExec("INSERT INTO city_population_history").WillReturnError(errors.New("disk full"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+				WithArgs("JPN").
+				WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+			mock.ExpectBegin()
+			tt.expect(mock)
+			// 失敗したらそれまでの手順も含めて全て取り消し、監査ログも書かない
+			mock.ExpectRollback()
+
+			e := echo.New()
+			e.POST("/admin/scenario", h.PostScenarioHandler, withUser("admin"))
+			rec := serveJSON(e, http.MethodPost, "/admin/scenario", body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultAnomalyThreshold は AnomalyThreshold が設定されていないときに使う標準偏差の倍数
+const defaultAnomalyThreshold = 3.0
+
+type CityAnomaly struct {
+	City
+	CountryMean   float64 `json:"countryMean"  db:"CountryMean"`
+	CountryStdDev float64 `json:"countryStdDev"  db:"CountryStdDev"`
+	ZScore        float64 `json:"zScore"  db:"ZScore"`
+}
+
+// GetCityAnomaliesHandler は国内の平均から標準偏差の threshold 倍以上離れた人口の都市を返す
+// 入力ミスの可能性があるデータを見つけるためのもの
+func (h *Handler) GetCityAnomaliesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	threshold := h.AnomalyThreshold
+	if threshold <= 0 {
+		threshold = defaultAnomalyThreshold
+	}
+	if s := c.QueryParam("threshold"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 {
+			return jsonError(c, http.StatusBadRequest, "threshold must be a positive number")
+		}
+		threshold = v
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	// 都市が1つしかない国などは標準偏差が0になるので除外する
+	anomalies := []CityAnomaly{}
+	err = h.db.SelectContext(ctx, &anomalies, `SELECT city.*, stats.CountryMean, stats.CountryStdDev,
+			(city.Population - stats.CountryMean) / stats.CountryStdDev AS ZScore
+		FROM city JOIN (
+			SELECT CountryCode, AVG(Population) AS CountryMean, STDDEV_POP(Population) AS CountryStdDev
+			FROM city WHERE Population IS NOT NULL
+			GROUP BY CountryCode HAVING CountryStdDev > 0
+		) AS stats ON city.CountryCode = stats.CountryCode
+		WHERE ABS(city.Population - stats.CountryMean) > ? * stats.CountryStdDev
+		ORDER BY ABS(ZScore) DESC, city.ID ASC LIMIT ? OFFSET ?`, threshold, limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get city anomalies", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, anomalies)
+}
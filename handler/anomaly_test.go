@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+var anomalyColumns = append(append([]string{}, cityColumns...), "CountryMean", "CountryStdDev", "ZScore")
+
+func TestGetCityAnomaliesHandlerFlagsOutlier(t *testing.T) {
+	// 人口10の都市が9つと1000の都市が1つの国: 平均109、標準偏差297で、1000の都市のZスコアは3
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`WHERE ABS\(city\.Population - stats\.CountryMean\) > \? \* stats\.CountryStdDev\s+ORDER BY ABS\(ZScore\) DESC, city\.ID ASC LIMIT \? OFFSET \?`).
+		WithArgs(2.5, defaultLimit, 0).
+		WillReturnRows(sqlmock.NewRows(anomalyColumns).
+			AddRow(10, "Outlier", "XYZ", "Somewhere", 1000, nil, nil, 109.0, 297.0, 3.0))
+
+	e := echo.New()
+	e.GET("/admin/cities/anomalies", h.GetCityAnomaliesHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cities/anomalies?threshold=2.5", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var anomalies []CityAnomaly
+	if err := json.Unmarshal(rec.Body.Bytes(), &anomalies); err != nil {
+		t.Fatal(err)
+	}
+	if len(anomalies) != 1 {
+		t.Fatalf("anomalies = %+v, want 1", anomalies)
+	}
+	got := anomalies[0]
+	if got.ID != 10 || got.CountryMean != 109 || got.CountryStdDev != 297 || got.ZScore != 3 {
+		t.Errorf("anomaly = %+v, want the outlier with mean 109, stddev 297 and z-score 3", got)
+	}
+}
+
+func TestGetCityAnomaliesHandlerThreshold(t *testing.T) {
+	tests := []struct {
+		name          string
+		configured    float64
+		query         string
+		wantThreshold float64
+	}{
+		{name: "default", wantThreshold: defaultAnomalyThreshold},
+		{name: "configured", configured: 2, wantThreshold: 2},
+		{name: "query overrides config", configured: 2, query: "?threshold=4", wantThreshold: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			h.AnomalyThreshold = tt.configured
+			mock.ExpectQuery("STDDEV_POP").
+				WithArgs(tt.wantThreshold, defaultLimit, 0).
+				WillReturnRows(sqlmock.NewRows(anomalyColumns))
+
+			e := echo.New()
+			e.GET("/admin/cities/anomalies", h.GetCityAnomaliesHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cities/anomalies"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+		})
+	}
+
+	for _, threshold := range []string{"0", "-1", "abc"} {
+		t.Run("invalid "+threshold, func(t *testing.T) {
+			h, _ := newMockHandler(t)
+			e := echo.New()
+			e.GET("/admin/cities/anomalies", h.GetCityAnomaliesHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cities/anomalies?threshold="+threshold, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
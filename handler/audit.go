@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuditEntry struct {
+	ID        int       `json:"id"  db:"ID"`
+	Username  string    `json:"username"  db:"Username"`
+	Action    string    `json:"action"  db:"Action"`
+	Target    string    `json:"target"  db:"Target"`
+	CreatedAt time.Time `json:"createdAt"  db:"CreatedAt"`
+}
+
+// cityTarget は監査ログの対象として記録する都市の表記を返す
+func cityTarget(id int) string {
+	return "city:" + strconv.Itoa(id)
+}
+
+// audit は username が target に対して action を行ったことを監査ログに記録する
+// 記録に失敗しても元の操作は成功しているので、ログに出すだけでエラーは返さない
+// リクエストのcontextがタイムアウト間際でも記録できるよう、別のcontextを使う
+func (h *Handler) audit(username, action, target string) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := h.db.ExecContext(ctx, "INSERT INTO audit_log (Username, Action, Target) VALUES (?, ?, ?)", username, action, target)
+	if err != nil {
+		h.Logger.Error("failed to write audit log", "username", username, "action", action, "target", target, "error", err)
+	}
+}
+
+// auditCities は username が ids の都市に対して action を行ったことを1つのINSERTでまとめて記録する
+// audit と同じく、記録に失敗しても元の操作は取り消さず、ログに出すだけにする
+func (h *Handler) auditCities(username, action string, ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, 0, len(ids)*3)
+	for i, id := range ids {
+		placeholders[i] = "(?, ?, ?)"
+		args = append(args, username, action, cityTarget(id))
+	}
+	_, err := h.db.ExecContext(ctx, "INSERT INTO audit_log (Username, Action, Target) VALUES "+strings.Join(placeholders, ", "), args...)
+	if err != nil {
+		h.Logger.Error("failed to write audit log", "username", username, "action", action, "targets", len(ids), "error", err)
+	}
+}
+
+// GetAuditLogHandler は監査ログを新しい順に返す。limit と offset でページングする
+func (h *Handler) GetAuditLogHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	entries := []AuditEntry{}
+	err = h.db.SelectContext(ctx, &entries, "SELECT * FROM audit_log ORDER BY CreatedAt DESC, ID DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get audit log", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, entries)
+}
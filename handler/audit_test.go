@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuditCities(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectExec(`INSERT INTO audit_log \(Username, Action, Target\) VALUES \(\?, \?, \?\), \(\?, \?, \?\), \(\?, \?, \?\)`).
+		WithArgs("alice", "create", "city:1", "alice", "create", "city:2", "alice", "create", "city:3").
+		WillReturnResult(sqlmock.NewResult(1, 3))
+
+	h.auditCities("alice", "create", []int{1, 2, 3})
+}
+
+func TestAuditCitiesWithoutIDs(t *testing.T) {
+	// 期待するクエリを設定しないので、何か実行されれば ExpectationsWereMet で失敗する
+	h, _ := newMockHandler(t)
+	h.auditCities("alice", "create", nil)
+}
+
+func TestBulkInsertKeepsCitiesWhenAuditFails(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+		WithArgs("JPN").
+		WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO city ").
+		WithArgs("Tokyo", "JPN", "Tokyo-to", 100, "alice").
+		WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec(`INSERT INTO city_population_history \(CityID, Population\) VALUES \(\?, \?\)$`).
+		WithArgs(10, 100).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnError(errors.New("audit_log is unavailable"))
+
+	e := echo.New()
+	e.POST("/cities/bulk", h.PostCitiesBulkHandler, withUser("alice"))
+	rec := serveJSON(e, http.MethodPost, "/cities/bulk", `[{"name": "Tokyo", "countryCode": "JPN", "district": "Tokyo-to", "population": 100}]`)
+
+	// 監査ログの記録に失敗しても、コミット済みの登録は取り消さずに201を返す
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BodyLimitMiddleware はリクエストボディを limit バイトまでに制限する
+// Content-Length が limit を超えていれば読み込まずに413を返す
+// Content-Length のないボディは http.MaxBytesReader で読み込みの途中で打ち切り、
+// そのエラーを受け取ったハンドラーが bodyError で413を返す
+// (middleware.BodyLimit は上限を超えた後もボディを読ませ続けるので、encoding/json がエラーを見落とすことがある)
+func BodyLimitMiddleware(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > limit {
+				return jsonError(c, http.StatusRequestEntityTooLarge, "request body too large")
+			}
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+			return next(c)
+		}
+	}
+}
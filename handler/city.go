@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) GetRecentCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	days, err := strconv.Atoi(c.QueryParam("days"))
+	if err != nil || days <= 0 {
+		return jsonError(c, http.StatusBadRequest, "days must be a positive integer")
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	cities := []City{}
+	err = h.db.SelectContext(ctx, &cities, "SELECT * FROM city WHERE CreatedAt >= NOW() - INTERVAL ? DAY ORDER BY CreatedAt DESC, ID DESC LIMIT ? OFFSET ?", days, limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get recent cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+func (h *Handler) GetCitiesByMagnitudeHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	digits, err := strconv.Atoi(c.QueryParam("digits"))
+	if err != nil || digits < 1 || digits > 10 {
+		return jsonError(c, http.StatusBadRequest, "digits must be an integer between 1 and 10")
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	lower, upper := magnitudeRange(digits)
+
+	cities := []City{}
+	err = h.db.SelectContext(ctx, &cities, "SELECT * FROM city WHERE Population BETWEEN ? AND ? ORDER BY Population DESC, ID ASC LIMIT ? OFFSET ?", lower, upper, limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get cities by magnitude", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+// magnitudeRange は人口がちょうど digits 桁になる範囲 [10^(digits-1), 10^digits - 1] を返す
+// 1桁のときは0も含める
+func magnitudeRange(digits int) (lower, upper int64) {
+	upper = 1
+	for i := 0; i < digits; i++ {
+		lower = upper
+		upper *= 10
+	}
+	if digits == 1 {
+		lower = 0
+	}
+	return lower, upper - 1
+}
+
+type PopulationHistory struct {
+	Population int       `json:"population"  db:"Population"`
+	RecordedAt time.Time `json:"recordedAt"  db:"RecordedAt"`
+}
+
+// recordPopulationHistory は都市の人口が変わったときに履歴を1行追加する
+func recordPopulationHistory(ctx context.Context, db sqlx.ExecerContext, cityID int, population int) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO city_population_history (CityID, Population) VALUES (?, ?)", cityID, population)
+	return err
+}
+
+func (h *Handler) GetCityPopulationHistoryHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "id must be an integer")
+	}
+
+	var count int
+	err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM city WHERE ID = ?", id)
+	if err != nil {
+		h.logger(c).Error("failed to get city", "error", err)
+		return internalError(c, err)
+	}
+	if count == 0 {
+		return jsonError(c, http.StatusNotFound, "not found")
+	}
+
+	history := []PopulationHistory{}
+	err = h.db.SelectContext(ctx, &history, "SELECT Population, RecordedAt FROM city_population_history WHERE CityID = ? ORDER BY RecordedAt ASC, ID ASC", id)
+	if err != nil {
+		h.logger(c).Error("failed to get population history", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, history)
+}
+
+type cityLetterCount struct {
+	Letter string `db:"Letter"`
+	Count  int    `db:"Count"`
+}
+
+func (h *Handler) GetCityIndexHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	countryCode := c.QueryParam("countryCode")
+
+	query := "SELECT UPPER(LEFT(Name, 1)) AS Letter, COUNT(*) AS Count FROM city"
+	args := []interface{}{}
+	if countryCode != "" {
+		var count int
+		err := h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM country WHERE Code = ?", countryCode)
+		if err != nil {
+			h.logger(c).Error("failed to get country", "error", err)
+			return internalError(c, err)
+		}
+		if count == 0 {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		query += " WHERE CountryCode = ?"
+		args = append(args, countryCode)
+	}
+	query += " GROUP BY Letter"
+
+	var rows []cityLetterCount
+	err := h.db.SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		h.logger(c).Error("failed to get city index", "error", err)
+		return internalError(c, err)
+	}
+
+	// 文字以外 (数字や記号) で始まる都市名は "#" にまとめる
+	index := map[string]int{}
+	for _, row := range rows {
+		letter := row.Letter
+		r, _ := utf8.DecodeRuneInString(letter)
+		if !unicode.IsLetter(r) {
+			letter = "#"
+		}
+		index[letter] += row.Count
+	}
+
+	return respondJSON(c, http.StatusOK, index)
+}
+
+func (h *Handler) GetSmallestCityHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	// 人口が0やNULLの都市は多いので除外する
+	query := "SELECT * FROM city WHERE Population IS NOT NULL AND Population > 0"
+	args := []interface{}{}
+	if countryCode := c.QueryParam("countryCode"); countryCode != "" {
+		query += " AND CountryCode = ?"
+		args = append(args, countryCode)
+	}
+	query += " ORDER BY Population ASC, ID ASC LIMIT 1"
+
+	var city City
+	err := h.db.GetContext(ctx, &city, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.NoContent(http.StatusNoContent)
+		}
+		h.logger(c).Error("failed to get smallest city", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, city)
+}
+
+func (h *Handler) GetCitiesByNameLengthHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	order := c.QueryParam("order")
+	switch order {
+	case "":
+		order = "DESC"
+	case "asc", "desc":
+		order = strings.ToUpper(order)
+	default:
+		return jsonError(c, http.StatusBadRequest, "order must be asc or desc")
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	cities := []City{}
+	err = h.db.SelectContext(ctx, &cities, "SELECT * FROM city ORDER BY CHAR_LENGTH(Name) "+order+", ID ASC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get cities by name length", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+type CityWithCountry struct {
+	City
+	CountryName string `json:"countryName"  db:"CountryName"`
+}
+
+func (h *Handler) GetCityNameCollisionsHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	name := c.QueryParam("name")
+
+	// 同じ名前の都市が2つ以上の国にある場合だけ返す
+	cities := []CityWithCountry{}
+	err := h.db.SelectContext(ctx, &cities, `SELECT city.*, country.Name AS CountryName
+		FROM city JOIN country ON city.CountryCode = country.Code
+		WHERE city.Name = ? AND (SELECT COUNT(DISTINCT CountryCode) FROM city WHERE Name = ?) > 1
+		ORDER BY country.Name ASC, city.ID ASC`, name, name)
+	if err != nil {
+		h.logger(c).Error("failed to get city name collisions", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+// maxRegexPatternLength は正規表現検索で受け付けるパターンの最大長
+const maxRegexPatternLength = 100
+
+// nestedQuantifierPattern は (a+)+ のような量指定子が入れ子になったパターンにマッチする
+// MySQLの正規表現エンジンはバックトラッキングするので、こうしたパターンは非常に遅くなりうる
+var nestedQuantifierPattern = regexp.MustCompile(`\([^)]*[+*][^)]*\)[+*{]`)
+
+// validateRegexPattern は都市名の検索に使う正規表現を、DBに渡す前にGoで検証する
+func validateRegexPattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("pattern is empty")
+	}
+	if len(pattern) > maxRegexPatternLength {
+		return errors.New("pattern is too long")
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return errors.New("pattern is invalid")
+	}
+	if nestedQuantifierPattern.MatchString(pattern) {
+		return errors.New("pattern has nested quantifiers")
+	}
+	return nil
+}
+
+func (h *Handler) GetCitiesByRegexHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	pattern := c.QueryParam("pattern")
+	err := validateRegexPattern(pattern)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	cities := []City{}
+	err = h.db.SelectContext(ctx, &cities, "SELECT * FROM city WHERE Name REGEXP ? ORDER BY Name ASC, ID ASC LIMIT ? OFFSET ?", pattern, limit, offset)
+	if err != nil {
+		if isRegexpError(err) {
+			return jsonError(c, http.StatusBadRequest, "pattern is invalid")
+		}
+		h.logger(c).Error("failed to get cities by regex", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+// GetCitiesByNameHandler は名前が一致する都市を全て返す
+// 一致する都市がなくても404ではなく空の配列を返す
+func (h *Handler) GetCitiesByNameHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	name := c.QueryParam("name")
+
+	cities := []City{}
+	err := h.db.SelectContext(ctx, &cities, "SELECT * FROM city WHERE Name=? ORDER BY ID ASC", name)
+	if err != nil {
+		h.logger(c).Error("failed to search cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+// autocompleteLimit は GetCityAutocompleteHandler が返す候補の最大件数
+const autocompleteLimit = 10
+
+// likeEscaper はLIKEのパターンで特別な意味を持つ文字をエスケープする
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetCityAutocompleteHandler は名前が prefix で始まる都市の名前を、人口の多い順に最大 autocompleteLimit 件返す
+// 同じ名前の都市が複数ある場合は1つにまとめ、その中で最も人口の多い都市の順位で並べる
+// prefix が空なら空の配列を返す
+func (h *Handler) GetCityAutocompleteHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	prefix := c.QueryParam("prefix")
+	names := []string{}
+	if prefix == "" {
+		return respondJSON(c, http.StatusOK, names)
+	}
+
+	err := h.db.SelectContext(ctx, &names, "SELECT Name FROM city WHERE Name LIKE ? GROUP BY Name ORDER BY MAX(Population) DESC, Name ASC LIMIT ?", likeEscaper.Replace(prefix)+"%", autocompleteLimit)
+	if err != nil {
+		h.logger(c).Error("failed to get autocomplete candidates", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, names)
+}
+
+// maxBatchCityIDs は PostCitiesBatchHandler が一度に受け付けるIDの最大件数
+const maxBatchCityIDs = 200
+
+type CityBatchRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// PostCitiesBatchHandler は ids で指定した都市をまとめて返す
+// 結果は ids と同じ順に並べ、存在しないIDは飛ばす。同じIDを複数回指定しても1件だけ返す
+func (h *Handler) PostCitiesBatchHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var req CityBatchRequest
+	err := c.Bind(&req)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+	if len(req.IDs) > maxBatchCityIDs {
+		return jsonError(c, http.StatusBadRequest, "too many ids (max "+strconv.Itoa(maxBatchCityIDs)+")")
+	}
+
+	cities := []City{}
+	if len(req.IDs) == 0 {
+		return respondJSON(c, http.StatusOK, cities)
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM city WHERE ID IN (?)", req.IDs)
+	if err != nil {
+		h.logger(c).Error("failed to build batch query", "error", err)
+		return internalError(c, err)
+	}
+	var found []City
+	err = h.db.SelectContext(ctx, &found, h.db.Rebind(query), args...)
+	if err != nil {
+		h.logger(c).Error("failed to get cities", "error", err)
+		return internalError(c, err)
+	}
+
+	byID := map[int]City{}
+	for _, city := range found {
+		byID[city.ID] = city
+	}
+	for _, id := range req.IDs {
+		if city, ok := byID[id]; ok {
+			cities = append(cities, city)
+			delete(byID, id)
+		}
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type citySort struct {
+	Column string
+	Desc   bool
+	// value はカーソルに保存する、並び替えに使うカラムの値を返す
+	value func(City) interface{}
+}
+
+// citySortOrders は sort パラメータで指定できる並び順
+// ここにないキーはSQLに渡さずに400を返す
+var citySortOrders = map[string]citySort{
+	"name_asc":        {Column: "Name", value: func(city City) interface{} { return city.Name.String }},
+	"name_desc":       {Column: "Name", Desc: true, value: func(city City) interface{} { return city.Name.String }},
+	"population_asc":  {Column: "Population", value: func(city City) interface{} { return city.Population.Int64 }},
+	"population_desc": {Column: "Population", Desc: true, value: func(city City) interface{} { return city.Population.Int64 }},
+	"district_asc":    {Column: "District", value: func(city City) interface{} { return city.District.String }},
+	"district_desc":   {Column: "District", Desc: true, value: func(city City) interface{} { return city.District.String }},
+}
+
+// orderBy は同じ値の都市をIDの昇順に並べるORDER BY句を返す
+func (s citySort) orderBy() string {
+	if s.Desc {
+		return s.Column + " DESC, ID ASC"
+	}
+	return s.Column + " ASC, ID ASC"
+}
+
+// cityCursor はカーソル方式のページングで、前のページの最後の都市の位置を表す
+type cityCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
+}
+
+func encodeCityCursor(sort citySort, city City) (string, error) {
+	value, err := json.Marshal(sort.value(city))
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(cityCursor{Value: value, ID: city.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// addCursorCondition は cursor より後ろの都市だけを返す条件を追加する
+func addCursorCondition(b *queryBuilder, sort citySort, cursor string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	var cur cityCursor
+	err = json.Unmarshal(raw, &cur)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+
+	var value interface{}
+	if sort.Column == "Population" {
+		var v int64
+		err = json.Unmarshal(cur.Value, &v)
+		value = v
+	} else {
+		var v string
+		err = json.Unmarshal(cur.Value, &v)
+		value = v
+	}
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+
+	op := ">"
+	if sort.Desc {
+		op = "<"
+	}
+	b.where("("+sort.Column+" "+op+" ? OR ("+sort.Column+" = ? AND ID > ?))", value, value, cur.ID)
+	return nil
+}
+
+type CityPage struct {
+	Items      []City `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+const defaultCitySort = "name_asc"
+
+// addPopulationRange はクエリパラメータの minPopulation と maxPopulation を column の条件として追加する
+func addPopulationRange(c echo.Context, b *queryBuilder, column string) error {
+	minPopulation, maxPopulation := -1, -1
+	if s := c.QueryParam("minPopulation"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return errors.New("minPopulation must be a non-negative integer")
+		}
+		minPopulation = v
+		b.where(column+" >= ?", v)
+	}
+	if s := c.QueryParam("maxPopulation"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return errors.New("maxPopulation must be a non-negative integer")
+		}
+		maxPopulation = v
+		b.where(column+" <= ?", v)
+	}
+	if minPopulation >= 0 && maxPopulation >= 0 && minPopulation > maxPopulation {
+		return errors.New("minPopulation must not be greater than maxPopulation")
+	}
+	return nil
+}
+
+// parseCityFilter は都市一覧の絞り込み条件をクエリパラメータから組み立てる
+func parseCityFilter(c echo.Context) (queryBuilder, error) {
+	b := queryBuilder{}
+	if countryCode := c.QueryParam("countryCode"); countryCode != "" {
+		b.where("CountryCode = ?", countryCode)
+	}
+	if district := c.QueryParam("district"); district != "" {
+		b.where("District = ?", district)
+	}
+	err := addPopulationRange(c, &b, "Population")
+	if err != nil {
+		return queryBuilder{}, err
+	}
+	return b, nil
+}
+
+// GetCitiesHandler は都市の一覧を絞り込み・並び替え・ページングして返す
+//
+//   - countryCode, district: 完全一致で絞り込む
+//   - minPopulation, maxPopulation: 人口の範囲 (両端を含む) で絞り込む。片方だけの指定もできる
+//   - sort: citySortOrders のキーのいずれか。省略時は name_asc。同じ値の都市はIDの昇順で並ぶ
+//   - paginationStyle: offset (デフォルト) か cursor
+//   - limit: 1ページの件数。どちらのページングでも使う
+//   - offset: offset 方式のときだけ指定できる。結果は都市の配列で、X-Total-Count と Link ヘッダーを付ける
+//   - cursor: cursor 方式のときだけ指定できる。前のページの nextCursor を渡す
+//     結果は {"items": [...], "nextCursor": "..."} で、最後のページでは nextCursor を省略する
+//
+// 絞り込み条件は全てANDで組み合わせる。不正な値があれば400を返す
+func (h *Handler) GetCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	b, err := parseCityFilter(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	sortKey := c.QueryParam("sort")
+	if sortKey == "" {
+		sortKey = defaultCitySort
+	}
+	sort, ok := citySortOrders[sortKey]
+	if !ok {
+		return jsonError(c, http.StatusBadRequest, "unknown sort key")
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	switch c.QueryParam("paginationStyle") {
+	case "", "offset":
+		if c.QueryParam("cursor") != "" {
+			return jsonError(c, http.StatusBadRequest, "cursor requires paginationStyle=cursor")
+		}
+
+		query := "SELECT * FROM city" + b.whereClause() + " ORDER BY " + sort.orderBy() + " LIMIT ? OFFSET ?"
+		args := append(b.args, limit, offset)
+
+		cities := []City{}
+		err = h.db.SelectContext(ctx, &cities, query, args...)
+		if err != nil {
+			h.logger(c).Error("failed to get cities", "error", err)
+			return internalError(c, err)
+		}
+
+		var total int
+		err = h.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM city"+b.whereClause(), b.args...)
+		if err != nil {
+			h.logger(c).Error("failed to count cities", "error", err)
+			return internalError(c, err)
+		}
+		setPaginationHeaders(c, total)
+
+		return respondJSON(c, http.StatusOK, cities)
+	case "cursor":
+		if c.QueryParam("offset") != "" {
+			return jsonError(c, http.StatusBadRequest, "offset cannot be used with paginationStyle=cursor")
+		}
+		if cursor := c.QueryParam("cursor"); cursor != "" {
+			err = addCursorCondition(&b, sort, cursor)
+			if err != nil {
+				return jsonError(c, http.StatusBadRequest, err.Error())
+			}
+		}
+
+		// 次のページがあるかを知るために1件多く取得する
+		query := "SELECT * FROM city" + b.whereClause() + " ORDER BY " + sort.orderBy() + " LIMIT ?"
+		args := append(b.args, limit+1)
+
+		cities := []City{}
+		err = h.db.SelectContext(ctx, &cities, query, args...)
+		if err != nil {
+			h.logger(c).Error("failed to get cities", "error", err)
+			return internalError(c, err)
+		}
+
+		page := CityPage{Items: cities}
+		if len(cities) > limit {
+			page.Items = cities[:limit]
+			page.NextCursor, err = encodeCityCursor(sort, page.Items[limit-1])
+			if err != nil {
+				h.logger(c).Error("failed to encode cursor", "error", err)
+				return internalError(c, err)
+			}
+		}
+
+		return respondJSON(c, http.StatusOK, page)
+	default:
+		return jsonError(c, http.StatusBadRequest, "paginationStyle must be offset or cursor")
+	}
+}
+
+type CityCount struct {
+	Count int `json:"count"`
+}
+
+// GetCityCountHandler は GetCitiesHandler と同じ絞り込み条件に一致する都市の数を返す
+func (h *Handler) GetCityCountHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	b, err := parseCityFilter(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	var count int
+	err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM city"+b.whereClause(), b.args...)
+	if err != nil {
+		h.logger(c).Error("failed to count cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, CityCount{Count: count})
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newQueryContext は query をクエリ文字列に持つGETリクエストの echo.Context を作る
+func newQueryContext(query string) (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/cities?"+query, nil)
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestParseCityFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantWhere string
+		wantArgs  []interface{}
+		wantErr   string
+	}{
+		{
+			name:      "no filters",
+			query:     "",
+			wantWhere: "",
+		},
+		{
+			name:      "country code",
+			query:     "countryCode=JPN",
+			wantWhere: " WHERE CountryCode = ?",
+			wantArgs:  []interface{}{"JPN"},
+		},
+		{
+			name:      "all filters",
+			query:     "countryCode=JPN&district=Tokyo-to&minPopulation=100&maxPopulation=200",
+			wantWhere: " WHERE CountryCode = ? AND District = ? AND Population >= ? AND Population <= ?",
+			wantArgs:  []interface{}{"JPN", "Tokyo-to", 100, 200},
+		},
+		{
+			name:      "only minPopulation",
+			query:     "minPopulation=0",
+			wantWhere: " WHERE Population >= ?",
+			wantArgs:  []interface{}{0},
+		},
+		{
+			name:      "only maxPopulation",
+			query:     "district=Kanto&maxPopulation=500",
+			wantWhere: " WHERE District = ? AND Population <= ?",
+			wantArgs:  []interface{}{"Kanto", 500},
+		},
+		{
+			name:      "min equals max",
+			query:     "minPopulation=100&maxPopulation=100",
+			wantWhere: " WHERE Population >= ? AND Population <= ?",
+			wantArgs:  []interface{}{100, 100},
+		},
+		{
+			name:    "min greater than max",
+			query:   "minPopulation=200&maxPopulation=100",
+			wantErr: "minPopulation must not be greater than maxPopulation",
+		},
+		{
+			name:    "negative minPopulation",
+			query:   "minPopulation=-1",
+			wantErr: "minPopulation must be a non-negative integer",
+		},
+		{
+			name:    "non-numeric maxPopulation",
+			query:   "maxPopulation=many",
+			wantErr: "maxPopulation must be a non-negative integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newQueryContext(tt.query)
+			b, err := parseCityFilter(c)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseCityFilter() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCityFilter() error = %v", err)
+			}
+			if got := b.whereClause(); got != tt.wantWhere {
+				t.Errorf("whereClause() = %q, want %q", got, tt.wantWhere)
+			}
+			if len(b.args) != 0 || len(tt.wantArgs) != 0 {
+				if !reflect.DeepEqual(b.args, tt.wantArgs) {
+					t.Errorf("args = %v, want %v", b.args, tt.wantArgs)
+				}
+			}
+		})
+	}
+}
+
+func TestAddPopulationRangeColumn(t *testing.T) {
+	c, _ := newQueryContext("minPopulation=10&maxPopulation=20")
+	b := queryBuilder{}
+	err := addPopulationRange(c, &b, "city.Population")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := " WHERE city.Population >= ? AND city.Population <= ?"
+	if got := b.whereClause(); got != want {
+		t.Fatalf("whereClause() = %q, want %q", got, want)
+	}
+}
+
+func TestGetCitiesHandlerRejectsInvalidFilter(t *testing.T) {
+	h := &Handler{}
+	for _, query := range []string{
+		"minPopulation=200&maxPopulation=100",
+		"minPopulation=abc",
+		"sort=unknown",
+		"paginationStyle=page",
+	} {
+		t.Run(query, func(t *testing.T) {
+			c, rec := newQueryContext(query)
+			err := h.GetCitiesHandler(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestCityCursorRoundTrip(t *testing.T) {
+	city := City{
+		ID:         42,
+		Name:       sql.NullString{String: "Tokyo", Valid: true},
+		District:   sql.NullString{String: "Tokyo-to", Valid: true},
+		Population: sql.NullInt64{Int64: 7980230, Valid: true},
+	}
+
+	tests := []struct {
+		sortKey   string
+		wantWhere string
+		wantValue interface{}
+	}{
+		{sortKey: "name_asc", wantWhere: " WHERE (Name > ? OR (Name = ? AND ID > ?))", wantValue: "Tokyo"},
+		{sortKey: "name_desc", wantWhere: " WHERE (Name < ? OR (Name = ? AND ID > ?))", wantValue: "Tokyo"},
+		{sortKey: "population_asc", wantWhere: " WHERE (Population > ? OR (Population = ? AND ID > ?))", wantValue: int64(7980230)},
+		{sortKey: "population_desc", wantWhere: " WHERE (Population < ? OR (Population = ? AND ID > ?))", wantValue: int64(7980230)},
+		{sortKey: "district_asc", wantWhere: " WHERE (District > ? OR (District = ? AND ID > ?))", wantValue: "Tokyo-to"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortKey, func(t *testing.T) {
+			sort := citySortOrders[tt.sortKey]
+			cursor, err := encodeCityCursor(sort, city)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b := queryBuilder{}
+			err = addCursorCondition(&b, sort, cursor)
+			if err != nil {
+				t.Fatalf("addCursorCondition() error = %v", err)
+			}
+			if got := b.whereClause(); got != tt.wantWhere {
+				t.Errorf("whereClause() = %q, want %q", got, tt.wantWhere)
+			}
+			wantArgs := []interface{}{tt.wantValue, tt.wantValue, 42}
+			if !reflect.DeepEqual(b.args, wantArgs) {
+				t.Errorf("args = %#v, want %#v", b.args, wantArgs)
+			}
+		})
+	}
+}
+
+func TestAddCursorConditionRejectsMalformedCursor(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name    string
+		sortKey string
+		cursor  string
+	}{
+		{name: "not base64", sortKey: "name_asc", cursor: "not base64!"},
+		{name: "padded base64", sortKey: "name_asc", cursor: base64.URLEncoding.EncodeToString([]byte(`{"v":"a","id":1}`))},
+		{name: "not json", sortKey: "name_asc", cursor: encode("not json")},
+		{name: "wrong json type", sortKey: "name_asc", cursor: encode(`[1, 2]`)},
+		{name: "number for name", sortKey: "name_asc", cursor: encode(`{"v":1,"id":1}`)},
+		{name: "string for population", sortKey: "population_desc", cursor: encode(`{"v":"many","id":1}`)},
+		{name: "missing value", sortKey: "name_asc", cursor: encode(`{"id":1}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := queryBuilder{}
+			err := addCursorCondition(&b, citySortOrders[tt.sortKey], tt.cursor)
+			if err == nil || err.Error() != "invalid cursor" {
+				t.Fatalf("addCursorCondition(%q) error = %v, want invalid cursor", tt.cursor, err)
+			}
+			if len(b.conditions) != 0 {
+				t.Errorf("conditions were added for an invalid cursor: %v", b.conditions)
+			}
+		})
+	}
+}
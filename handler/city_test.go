@@ -0,0 +1,552 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+)
+
+func TestValidateRegexPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{pattern: "^San ", wantErr: ""},
+		{pattern: "^(New|Old) ", wantErr: ""},
+		{pattern: "[0-9]+$", wantErr: ""},
+		{pattern: strings.Repeat("a", maxRegexPatternLength), wantErr: ""},
+		{pattern: "", wantErr: "pattern is empty"},
+		{pattern: strings.Repeat("a", maxRegexPatternLength+1), wantErr: "pattern is too long"},
+		{pattern: "(", wantErr: "pattern is invalid"},
+		{pattern: "[a-", wantErr: "pattern is invalid"},
+		{pattern: "(a+)+$", wantErr: "pattern has nested quantifiers"},
+		{pattern: "(a*)*", wantErr: "pattern has nested quantifiers"},
+		{pattern: "(ab+){2,}", wantErr: "pattern has nested quantifiers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := validateRegexPattern(tt.pattern)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateRegexPattern(%q) error = %v", tt.pattern, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("validateRegexPattern(%q) error = %v, want %q", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetCitiesByRegexHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		dbErr   error
+		want    int
+	}{
+		{name: "valid pattern", pattern: "^San ", want: http.StatusOK},
+		{name: "invalid in go", pattern: "(", want: http.StatusBadRequest},
+		// RE2では受け付けるが、MySQLのICUでは名前付きグループの書き方が異なる
+		{name: "invalid in mysql", pattern: "(?P<n>a)", dbErr: &mysql.MySQLError{Number: 3688, Message: "Syntax error in regular expression on line 1, character 3."}, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			if tt.want == http.StatusOK || tt.dbErr != nil {
+				query := mock.ExpectQuery("SELECT \\* FROM city WHERE Name REGEXP \\?").WithArgs(tt.pattern, sqlmock.AnyArg(), sqlmock.AnyArg())
+				if tt.dbErr != nil {
+					query.WillReturnError(tt.dbErr)
+				} else {
+					query.WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1, "San Jose", "USA", "California", 894943, nil, nil))
+				}
+			}
+
+			e := echo.New()
+			e.GET("/cities/regex", h.GetCitiesByRegexHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/regex?pattern="+url.QueryEscape(tt.pattern), nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMagnitudeRange(t *testing.T) {
+	tests := []struct {
+		digits    int
+		wantLower int64
+		wantUpper int64
+	}{
+		{digits: 1, wantLower: 0, wantUpper: 9},
+		{digits: 2, wantLower: 10, wantUpper: 99},
+		{digits: 3, wantLower: 100, wantUpper: 999},
+		{digits: 7, wantLower: 1000000, wantUpper: 9999999},
+		{digits: 10, wantLower: 1000000000, wantUpper: 9999999999},
+	}
+
+	for _, tt := range tests {
+		lower, upper := magnitudeRange(tt.digits)
+		if lower != tt.wantLower || upper != tt.wantUpper {
+			t.Errorf("magnitudeRange(%d) = [%d, %d], want [%d, %d]", tt.digits, lower, upper, tt.wantLower, tt.wantUpper)
+		}
+	}
+}
+
+// 境界の人口が、ちょうど1つの桁数の範囲にだけ入ることを確かめる
+func TestMagnitudeRangeBoundaries(t *testing.T) {
+	tests := []struct {
+		population int64
+		wantDigits int
+	}{
+		{population: 0, wantDigits: 1},
+		{population: 9, wantDigits: 1},
+		{population: 10, wantDigits: 2},
+		{population: 99, wantDigits: 2},
+		{population: 100, wantDigits: 3},
+	}
+
+	for _, tt := range tests {
+		for digits := 1; digits <= 10; digits++ {
+			lower, upper := magnitudeRange(digits)
+			inRange := lower <= tt.population && tt.population <= upper
+			if inRange != (digits == tt.wantDigits) {
+				t.Errorf("population %d in range of %d digits [%d, %d] = %v, want %v", tt.population, digits, lower, upper, inRange, digits == tt.wantDigits)
+			}
+		}
+	}
+}
+
+func TestGetRecentCitiesHandler(t *testing.T) {
+	now := time.Now()
+
+	t.Run("window and order", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		// 期間はSQLで NOW() から days 日前までに絞り、作成日時の新しい順に並べる
+		mock.ExpectQuery(`SELECT \* FROM city WHERE CreatedAt >= NOW\(\) - INTERVAL \? DAY ORDER BY CreatedAt DESC, ID DESC LIMIT \? OFFSET \?`).
+			WithArgs(7, 2, 0).
+			WillReturnRows(sqlmock.NewRows(cityColumns).
+				AddRow(5, "Kyoto", "JPN", "Kyoto", 100, now.Add(-time.Hour), "alice").
+				AddRow(4, "Osaka", "JPN", "Osaka", 100, now.Add(-3*24*time.Hour), "alice"))
+
+		e := echo.New()
+		e.GET("/cities/recent", h.GetRecentCitiesHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/recent?days=7&limit=2", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var cities []City
+		if err := json.Unmarshal(rec.Body.Bytes(), &cities); err != nil {
+			t.Fatal(err)
+		}
+		if len(cities) != 2 || cities[0].ID != 5 || cities[1].ID != 4 {
+			t.Errorf("cities = %+v, want IDs [5 4]", cities)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT \* FROM city WHERE CreatedAt >= NOW\(\) - INTERVAL \? DAY`).
+			WithArgs(1, defaultLimit, 0).
+			WillReturnRows(sqlmock.NewRows(cityColumns))
+
+		e := echo.New()
+		e.GET("/cities/recent", h.GetRecentCitiesHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/recent?days=1", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("body = %s, want []", body)
+		}
+	})
+
+	for _, days := range []string{"", "0", "-1", "abc"} {
+		t.Run("invalid days "+days, func(t *testing.T) {
+			// DBに触る前に400を返す
+			h, _ := newMockHandler(t)
+			e := echo.New()
+			e.GET("/cities/recent", h.GetRecentCitiesHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/recent?days="+url.QueryEscape(days), nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestUpdateCityHandlerAppendsPopulationHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantHistory bool
+	}{
+		{name: "population changed", body: `{"population": 200}`, wantHistory: true},
+		// 同じ人口を指定しても履歴は増やさない
+		{name: "population unchanged", body: `{"population": 100}`, wantHistory: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT \* FROM city WHERE ID=\? FOR UPDATE`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1, "Tokyo", "JPN", "Tokyo-to", 100, nil, nil))
+			mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+				WithArgs("JPN").
+				WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+			mock.ExpectExec(`UPDATE city SET Population = \? WHERE ID=\?`).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.wantHistory {
+				mock.ExpectExec(`INSERT INTO city_population_history \(CityID, Population\) VALUES \(\?, \?\)`).
+					WithArgs(1, 200).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			mock.ExpectCommit()
+			mock.ExpectQuery(`SELECT \* FROM city WHERE ID=\?`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1, "Tokyo", "JPN", "Tokyo-to", 200, nil, nil))
+			mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+			e := echo.New()
+			e.PATCH("/cities/:id", h.UpdateCityHandler, withUser("alice"))
+			rec := serveJSON(e, http.MethodPatch, "/cities/1", tt.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetCityPopulationHistoryHandler(t *testing.T) {
+	recordedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("ordered series", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM city WHERE ID = \?`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+		mock.ExpectQuery(`SELECT Population, RecordedAt FROM city_population_history WHERE CityID = \? ORDER BY RecordedAt ASC, ID ASC`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"Population", "RecordedAt"}).
+				AddRow(100, recordedAt).
+				AddRow(200, recordedAt.Add(time.Hour)))
+
+		e := echo.New()
+		e.GET("/cities/:id/history", h.GetCityPopulationHistoryHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/1/history", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var history []PopulationHistory
+		if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+		want := []PopulationHistory{
+			{Population: 100, RecordedAt: recordedAt},
+			{Population: 200, RecordedAt: recordedAt.Add(time.Hour)},
+		}
+		if len(history) != len(want) {
+			t.Fatalf("history = %+v, want %+v", history, want)
+		}
+		for i := range want {
+			if history[i].Population != want[i].Population || !history[i].RecordedAt.Equal(want[i].RecordedAt) {
+				t.Errorf("history[%d] = %+v, want %+v", i, history[i], want[i])
+			}
+		}
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM city WHERE ID = \?`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+		mock.ExpectQuery("SELECT Population, RecordedAt FROM city_population_history").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"Population", "RecordedAt"}))
+
+		e := echo.New()
+		e.GET("/cities/:id/history", h.GetCityPopulationHistoryHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/1/history", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("body = %s, want []", body)
+		}
+	})
+}
+
+func TestGetCityIndexHandler(t *testing.T) {
+	t.Run("buckets sum to the total", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM country WHERE Code = \?`).
+			WithArgs("JPN").
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+		rows := sqlmock.NewRows([]string{"Letter", "Count"}).
+			AddRow("A", 12).
+			AddRow("B", 5).
+			AddRow("Ö", 2).
+			AddRow("1", 1).
+			AddRow("'", 3)
+		mock.ExpectQuery(`SELECT UPPER\(LEFT\(Name, 1\)\) AS Letter, COUNT\(\*\) AS Count FROM city WHERE CountryCode = \? GROUP BY Letter`).
+			WithArgs("JPN").
+			WillReturnRows(rows)
+		const total = 12 + 5 + 2 + 1 + 3
+
+		e := echo.New()
+		e.GET("/cities/index", h.GetCityIndexHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/index?countryCode=JPN", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var index map[string]int
+		if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+			t.Fatal(err)
+		}
+		sum := 0
+		for _, count := range index {
+			sum += count
+		}
+		if sum != total {
+			t.Errorf("sum of buckets = %d, want %d: %v", sum, total, index)
+		}
+		// 文字以外で始まる名前は "#" にまとめ、ASCII以外の文字はそのまま使う
+		want := map[string]int{"A": 12, "B": 5, "Ö": 2, "#": 4}
+		if !reflect.DeepEqual(index, want) {
+			t.Errorf("index = %v, want %v", index, want)
+		}
+	})
+
+	t.Run("unknown country", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM country WHERE Code = \?`).
+			WithArgs("XXX").
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+
+		e := echo.New()
+		e.GET("/cities/index", h.GetCityIndexHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/index?countryCode=XXX", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body.String())
+		}
+	})
+}
+
+func TestGetSmallestCityHandler(t *testing.T) {
+	t.Run("zero and null populations are excluded", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT \* FROM city WHERE Population IS NOT NULL AND Population > 0 AND CountryCode = \? ORDER BY Population ASC, ID ASC LIMIT 1`).
+			WithArgs("JPN").
+			WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(7, "Tiny", "JPN", "Tottori", 42, nil, nil))
+
+		e := echo.New()
+		e.GET("/cities/smallest", h.GetSmallestCityHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/smallest?countryCode=JPN", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var city City
+		if err := json.Unmarshal(rec.Body.Bytes(), &city); err != nil {
+			t.Fatal(err)
+		}
+		if city.ID != 7 || city.Population.Int64 != 42 {
+			t.Errorf("city = %+v, want ID 7 with population 42", city)
+		}
+	})
+
+	t.Run("none qualify", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT \* FROM city WHERE Population IS NOT NULL AND Population > 0 ORDER BY Population ASC, ID ASC LIMIT 1`).
+			WithoutArgs().
+			WillReturnRows(sqlmock.NewRows(cityColumns))
+
+		e := echo.New()
+		e.GET("/cities/smallest", h.GetSmallestCityHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/smallest", nil))
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+		}
+	})
+}
+
+func TestGetCitiesByNameLengthHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantOrder string
+	}{
+		{name: "default is descending", query: "", wantOrder: "DESC"},
+		{name: "descending", query: "?order=desc", wantOrder: "DESC"},
+		{name: "ascending", query: "?order=asc", wantOrder: "ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			rows := sqlmock.NewRows(cityColumns)
+			if tt.wantOrder == "DESC" {
+				rows.AddRow(1, "Santa Cruz de la Sierra", "BOL", "Santa Cruz", 935361, nil, nil).
+					AddRow(2, "Tokyo", "JPN", "Tokyo-to", 7980230, nil, nil)
+			} else {
+				rows.AddRow(3, "Ely", "GBR", "England", 1, nil, nil)
+			}
+			mock.ExpectQuery(`SELECT \* FROM city ORDER BY CHAR_LENGTH\(Name\) `+tt.wantOrder+`, ID ASC LIMIT \? OFFSET \?`).
+				WithArgs(defaultLimit, 0).
+				WillReturnRows(rows)
+
+			e := echo.New()
+			e.GET("/cities/by-name-length", h.GetCitiesByNameLengthHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/by-name-length"+tt.query, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			var cities []City
+			if err := json.Unmarshal(rec.Body.Bytes(), &cities); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantOrder == "DESC" && (len(cities) == 0 || cities[0].Name.String != "Santa Cruz de la Sierra") {
+				t.Errorf("cities = %+v, want the longest name first", cities)
+			}
+		})
+	}
+
+	t.Run("invalid order", func(t *testing.T) {
+		// DBに触る前に400を返すので、ORDER BY に任意の文字列は渡らない
+		h, _ := newMockHandler(t)
+		e := echo.New()
+		e.GET("/cities/by-name-length", h.GetCitiesByNameLengthHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/by-name-length?order="+url.QueryEscape("desc; DROP TABLE city"), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestGetCityNameCollisionsHandler(t *testing.T) {
+	collisionColumns := append(append([]string{}, cityColumns...), "CountryName")
+
+	t.Run("name in several countries", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`WHERE city\.Name = \? AND \(SELECT COUNT\(DISTINCT CountryCode\) FROM city WHERE Name = \?\) > 1`).
+			WithArgs("Victoria", "Victoria").
+			WillReturnRows(sqlmock.NewRows(collisionColumns).
+				AddRow(1, "Victoria", "CAN", "British Colombia", 73504, nil, nil, "Canada").
+				AddRow(2, "Victoria", "HKG", "Hongkong", 1312637, nil, nil, "Hong Kong").
+				AddRow(3, "Victoria", "SYC", "Mahé", 41000, nil, nil, "Seychelles"))
+
+		e := echo.New()
+		e.GET("/cities/name-collisions", h.GetCityNameCollisionsHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/name-collisions?name=Victoria", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var cities []CityWithCountry
+		if err := json.Unmarshal(rec.Body.Bytes(), &cities); err != nil {
+			t.Fatal(err)
+		}
+		countries := []string{}
+		for _, city := range cities {
+			countries = append(countries, city.CountryName)
+		}
+		if want := []string{"Canada", "Hong Kong", "Seychelles"}; !reflect.DeepEqual(countries, want) {
+			t.Errorf("countries = %v, want %v", countries, want)
+		}
+	})
+
+	t.Run("unique name", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`WHERE city\.Name = \?`).
+			WithArgs("Tokyo", "Tokyo").
+			WillReturnRows(sqlmock.NewRows(collisionColumns))
+
+		e := echo.New()
+		e.GET("/cities/name-collisions", h.GetCityNameCollisionsHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/name-collisions?name=Tokyo", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("body = %s, want []", body)
+		}
+	})
+}
+
+func TestGetCityInfoHandlerCaseInsensitive(t *testing.T) {
+	for _, name := range []string{"Tokyo", "tokyo", "TOKYO", "tOkYo"} {
+		t.Run(name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			// 大文字小文字を区別せずに探し、同名の都市が複数あればIDの小さいものを返す
+			mock.ExpectQuery(`SELECT \* FROM city WHERE LOWER\(Name\)=LOWER\(\?\) ORDER BY ID ASC LIMIT 1`).
+				WithArgs(name).
+				WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1532, "Tokyo", "JPN", "Tokyo-to", 7980230, nil, nil))
+
+			e := echo.New()
+			e.GET("/cities/:cityName", h.GetCityInfoHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/"+name, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			var city City
+			if err := json.Unmarshal(rec.Body.Bytes(), &city); err != nil {
+				t.Fatal(err)
+			}
+			if city.ID != 1532 || city.Name.String != "Tokyo" {
+				t.Errorf("city = %+v, want Tokyo (1532)", city)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		mock.ExpectQuery(`SELECT \* FROM city WHERE LOWER\(Name\)=LOWER\(\?\)`).
+			WithArgs("Atlantis").
+			WillReturnRows(sqlmock.NewRows(cityColumns))
+
+		e := echo.New()
+		e.GET("/cities/:cityName", h.GetCityInfoHandler)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cities/Atlantis", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body.String())
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+type CompressConfig struct {
+	// Algorithms は優先順に並べた圧縮方式 ("br", "gzip")
+	Algorithms []string
+	// MinLength より小さいレスポンスは圧縮しない
+	MinLength int
+}
+
+var compressEncoders = map[string]func(io.Writer) io.WriteCloser{
+	"br": func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriter(w)
+	},
+	"gzip": func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+}
+
+// CompressMiddleware はAccept-Encodingを見て、config.Algorithms の優先順で
+// クライアントが受け付ける方式でレスポンスを圧縮する
+// どれも受け付けない場合は圧縮しない
+func CompressMiddleware(config CompressConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+			encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding), config.Algorithms)
+			if encoding == "" {
+				return next(c)
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: res.Writer,
+				encoding:       encoding,
+				minLength:      config.MinLength,
+			}
+			res.Writer = cw
+			defer func() {
+				cw.close()
+				res.Writer = cw.ResponseWriter
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// negotiateEncoding は algorithms のうち、Accept-Encoding で受け付けられる最初のものを返す
+func negotiateEncoding(acceptEncoding string, algorithms []string) string {
+	accepted := map[string]bool{}
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q > 0
+			continue
+		}
+		accepted[name] = q > 0
+	}
+
+	for _, algorithm := range algorithms {
+		if _, ok := compressEncoders[algorithm]; !ok {
+			continue
+		}
+		if ok, listed := accepted[algorithm]; ok || (!listed && wildcard) {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// compressWriter は minLength に達するまで書き込みをバッファし、
+// 達した時点で圧縮を開始する
+type compressWriter struct {
+	http.ResponseWriter
+	encoding  string
+	minLength int
+
+	status  int
+	buf     bytes.Buffer
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	n, _ := w.buf.Write(b)
+	if w.buf.Len() >= w.minLength {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (w *compressWriter) start() error {
+	header := w.Header()
+	if header.Get(echo.HeaderContentEncoding) != "" {
+		// 既にエンコードされているレスポンスはそのまま返す
+		w.encoder = nopWriteCloser{w.ResponseWriter}
+	} else {
+		header.Del(echo.HeaderContentLength)
+		header.Set(echo.HeaderContentEncoding, w.encoding)
+		w.encoder = compressEncoders[w.encoding](w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode())
+	_, err := w.encoder.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *compressWriter) close() {
+	if w.encoder != nil {
+		w.encoder.Close()
+		return
+	}
+	if w.status == 0 && w.buf.Len() == 0 {
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode())
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+func (w *compressWriter) Flush() {
+	if w.encoder == nil {
+		if err := w.start(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
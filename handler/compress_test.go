@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	brFirst := []string{"br", "gzip"}
+	gzipFirst := []string{"gzip", "br"}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		algorithms     []string
+		want           string
+	}{
+		{name: "no header", acceptEncoding: "", algorithms: brFirst, want: ""},
+		{name: "gzip only", acceptEncoding: "gzip", algorithms: brFirst, want: "gzip"},
+		{name: "server prefers br", acceptEncoding: "gzip, br", algorithms: brFirst, want: "br"},
+		{name: "server prefers gzip", acceptEncoding: "gzip, br", algorithms: gzipFirst, want: "gzip"},
+		{name: "br rejected with q=0", acceptEncoding: "br;q=0, gzip", algorithms: brFirst, want: "gzip"},
+		{name: "all rejected", acceptEncoding: "br;q=0, gzip;q=0", algorithms: brFirst, want: ""},
+		{name: "low q still accepted", acceptEncoding: "br;q=0.1", algorithms: brFirst, want: "br"},
+		{name: "identity only", acceptEncoding: "identity", algorithms: brFirst, want: ""},
+		{name: "identity rejected", acceptEncoding: "identity;q=0, gzip", algorithms: brFirst, want: "gzip"},
+		{name: "wildcard", acceptEncoding: "*", algorithms: gzipFirst, want: "gzip"},
+		{name: "wildcard does not override q=0", acceptEncoding: "gzip;q=0, *", algorithms: gzipFirst, want: "br"},
+		{name: "wildcard rejected", acceptEncoding: "*;q=0", algorithms: brFirst, want: ""},
+		{name: "case and spaces", acceptEncoding: " GZIP ; q=1 ", algorithms: brFirst, want: "gzip"},
+		{name: "unknown algorithm ignored", acceptEncoding: "zstd, gzip", algorithms: []string{"zstd", "gzip"}, want: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := negotiateEncoding(tt.acceptEncoding, tt.algorithms)
+			if got != tt.want {
+				t.Fatalf("negotiateEncoding(%q, %v) = %q, want %q", tt.acceptEncoding, tt.algorithms, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	body := strings.Repeat("compress me ", 100)
+
+	e := echo.New()
+	e.Use(CompressMiddleware(CompressConfig{Algorithms: []string{"br", "gzip"}, MinLength: 100}))
+	e.GET("/large", func(c echo.Context) error { return c.String(http.StatusOK, body) })
+	e.GET("/small", func(c echo.Context) error { return c.String(http.StatusOK, "small") })
+
+	t.Run("compresses large response", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/large", nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(echo.HeaderVary); got != echo.HeaderAcceptEncoding {
+			t.Errorf("Vary = %q, want %q", got, echo.HeaderAcceptEncoding)
+		}
+		if got := rec.Header().Get(echo.HeaderContentEncoding); got != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", got)
+		}
+		r, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != body {
+			t.Errorf("decoded body does not match")
+		}
+	})
+
+	t.Run("leaves small response uncompressed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/small", nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(echo.HeaderVary); got != echo.HeaderAcceptEncoding {
+			t.Errorf("Vary = %q, want %q", got, echo.HeaderAcceptEncoding)
+		}
+		if got := rec.Header().Get(echo.HeaderContentEncoding); got != "" {
+			t.Errorf("Content-Encoding = %q, want empty", got)
+		}
+		if rec.Body.String() != "small" {
+			t.Errorf("body = %q, want %q", rec.Body.String(), "small")
+		}
+	})
+
+	t.Run("no acceptable encoding", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/large", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(echo.HeaderVary); got != echo.HeaderAcceptEncoding {
+			t.Errorf("Vary = %q, want %q", got, echo.HeaderAcceptEncoding)
+		}
+		if got := rec.Header().Get(echo.HeaderContentEncoding); got != "" {
+			t.Errorf("Content-Encoding = %q, want empty", got)
+		}
+		if rec.Body.String() != body {
+			t.Errorf("body does not match")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) GetContinentCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	continent := c.Param("continent")
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	b := queryBuilder{}
+	b.where("country.Continent = ?", continent)
+	err = addPopulationRange(c, &b, "city.Population")
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+	query := "SELECT city.* FROM city JOIN country ON city.CountryCode = country.Code" + b.whereClause() + " ORDER BY city.Population DESC, city.ID ASC LIMIT ? OFFSET ?"
+	args := append(b.args, limit, offset)
+
+	// 存在しない大陸名は404を返す
+	var count int
+	err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM country WHERE Continent = ?", continent)
+	if err != nil {
+		h.logger(c).Error("failed to get continent", "error", err)
+		return internalError(c, err)
+	}
+	if count == 0 {
+		return jsonError(c, http.StatusNotFound, "not found")
+	}
+
+	cities := []City{}
+	err = h.db.SelectContext(ctx, &cities, query, args...)
+	if err != nil {
+		h.logger(c).Error("failed to get continent cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+type ContinentAveragePopulation struct {
+	Continent         string  `json:"continent"  db:"Continent"`
+	AveragePopulation float64 `json:"averagePopulation"  db:"AveragePopulation"`
+}
+
+func (h *Handler) GetContinentAveragePopulationHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	averages := []ContinentAveragePopulation{}
+	err := h.db.SelectContext(ctx, &averages, `SELECT country.Continent, AVG(city.Population) AS AveragePopulation
+		FROM city JOIN country ON city.CountryCode = country.Code
+		WHERE city.Population IS NOT NULL
+		GROUP BY country.Continent
+		ORDER BY AveragePopulation DESC`)
+	if err != nil {
+		h.logger(c).Error("failed to get average population", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, averages)
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetContinentCitiesHandlerPopulationRange(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM country WHERE Continent = \?`).
+		WithArgs("Asia").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(51))
+	// 人口の範囲はSQLの条件として渡し、範囲内の都市だけを取得する
+	mock.ExpectQuery(`SELECT city\.\* FROM city JOIN country ON city\.CountryCode = country\.Code WHERE country\.Continent = \? AND city\.Population >= \? AND city\.Population <= \? ORDER BY city\.Population DESC, city\.ID ASC LIMIT \? OFFSET \?`).
+		WithArgs("Asia", 1000000, 5000000, defaultLimit, 0).
+		WillReturnRows(sqlmock.NewRows(cityColumns).
+			AddRow(2, "Osaka", "JPN", "Osaka", 2595674, nil, nil).
+			AddRow(3, "Nagoya", "JPN", "Aichi", 2154376, nil, nil))
+
+	e := echo.New()
+	e.GET("/continents/:continent/cities", h.GetContinentCitiesHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/continents/Asia/cities?minPopulation=1000000&maxPopulation=5000000", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var cities []City
+	if err := json.Unmarshal(rec.Body.Bytes(), &cities); err != nil {
+		t.Fatal(err)
+	}
+	if len(cities) != 2 {
+		t.Fatalf("cities = %+v, want 2", cities)
+	}
+	for _, city := range cities {
+		if population := city.Population.Int64; population < 1000000 || population > 5000000 {
+			t.Errorf("population %d is out of range", population)
+		}
+	}
+}
+
+func TestGetContinentCitiesHandlerRejectsBadRange(t *testing.T) {
+	// DBに触る前に400を返す
+	h, _ := newMockHandler(t)
+	e := echo.New()
+	e.GET("/continents/:continent/cities", h.GetContinentCitiesHandler)
+
+	for _, query := range []string{"minPopulation=-1", "maxPopulation=abc", "minPopulation=10&maxPopulation=5"} {
+		t.Run(query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/continents/Asia/cities?"+query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetContinentCitiesHandlerUnknownContinent(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM country WHERE Continent = \?`).
+		WithArgs("Atlantis").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+
+	e := echo.New()
+	e.GET("/continents/:continent/cities", h.GetContinentCitiesHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/continents/Atlantis/cities?minPopulation=1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body.String())
+	}
+}
+
+func TestGetContinentAveragePopulationHandler(t *testing.T) {
+	// 小さなデータで手計算した平均 (NULLの都市は平均に含めない)
+	// Asia: (300 + 100) / 2 = 200, Europe: (50 + 70 + 90) / 3 = 70
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`SELECT country\.Continent, AVG\(city\.Population\) AS AveragePopulation\s+FROM city JOIN country ON city\.CountryCode = country\.Code\s+WHERE city\.Population IS NOT NULL\s+GROUP BY country\.Continent\s+ORDER BY AveragePopulation DESC`).
+		WillReturnRows(sqlmock.NewRows([]string{"Continent", "AveragePopulation"}).
+			AddRow("Asia", (300.0+100.0)/2).
+			AddRow("Europe", (50.0+70.0+90.0)/3))
+
+	e := echo.New()
+	e.GET("/continents/average-population", h.GetContinentAveragePopulationHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/continents/average-population", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var averages []ContinentAveragePopulation
+	if err := json.Unmarshal(rec.Body.Bytes(), &averages); err != nil {
+		t.Fatal(err)
+	}
+	want := []ContinentAveragePopulation{
+		{Continent: "Asia", AveragePopulation: 200},
+		{Continent: "Europe", AveragePopulation: 70},
+	}
+	if !reflect.DeepEqual(averages, want) {
+		t.Errorf("averages = %+v, want %+v", averages, want)
+	}
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Country struct {
+	Code           string          `json:"code,omitempty"  db:"Code"`
+	Name           string          `json:"name,omitempty"  db:"Name"`
+	Continent      string          `json:"continent,omitempty"  db:"Continent"`
+	Region         string          `json:"region,omitempty"  db:"Region"`
+	SurfaceArea    float64         `json:"surfaceArea,omitempty"  db:"SurfaceArea"`
+	IndepYear      sql.NullInt16   `json:"indepYear,omitempty"  db:"IndepYear"`
+	Population     int             `json:"population,omitempty"  db:"Population"`
+	LifeExpectancy sql.NullFloat64 `json:"lifeExpectancy,omitempty"  db:"LifeExpectancy"`
+	GNP            sql.NullFloat64 `json:"gnp,omitempty"  db:"GNP"`
+	GNPOld         sql.NullFloat64 `json:"gnpOld,omitempty"  db:"GNPOld"`
+	LocalName      string          `json:"localName,omitempty"  db:"LocalName"`
+	GovernmentForm string          `json:"governmentForm,omitempty"  db:"GovernmentForm"`
+	HeadOfState    sql.NullString  `json:"headOfState,omitempty"  db:"HeadOfState"`
+	Capital        sql.NullInt64   `json:"capital,omitempty"  db:"Capital"`
+	Code2          string          `json:"code2,omitempty"  db:"Code2"`
+}
+
+// localizedCountryColumns は country の全カラムを、Name だけ翻訳名に置き換えて選ぶ
+// country_translation を t として LEFT JOIN し、翻訳がなければ英語名にフォールバックする
+const localizedCountryColumns = `country.Code, COALESCE(t.Name, country.Name) AS Name, country.Continent, country.Region,
+	country.SurfaceArea, country.IndepYear, country.Population, country.LifeExpectancy, country.GNP, country.GNPOld,
+	country.LocalName, country.GovernmentForm, country.HeadOfState, country.Capital, country.Code2`
+
+// localizedCountryJoin は localizedCountryColumns と組み合わせる翻訳テーブルの結合
+// 最初の引数に preferredLanguage の言語を渡す
+const localizedCountryJoin = " LEFT JOIN country_translation t ON t.CountryCode = country.Code AND t.Language = ?"
+
+func (h *Handler) GetCountryHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	code := c.Param("code")
+
+	var country Country
+	err := h.db.GetContext(ctx, &country, "SELECT "+localizedCountryColumns+" FROM country"+localizedCountryJoin+" WHERE country.Code=?", preferredLanguage(c), code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to get country data", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, country)
+}
+
+// GetCountriesHandler は国の一覧を国名順に返す
+// continent を指定するとその大陸の国だけに絞り込む。limit と offset でページングし、X-Total-Count と Link ヘッダーを付ける
+func (h *Handler) GetCountriesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	b := queryBuilder{}
+	if continent := c.QueryParam("continent"); continent != "" {
+		b.where("Continent = ?", continent)
+	}
+	// 国名は翻訳名で返し、並び順も翻訳名に合わせる
+	query := "SELECT " + localizedCountryColumns + " FROM country" + localizedCountryJoin + b.whereClause() + " ORDER BY Name ASC, country.Code ASC LIMIT ? OFFSET ?"
+	args := append([]interface{}{preferredLanguage(c)}, b.args...)
+	args = append(args, limit, offset)
+
+	countries := []Country{}
+	err = h.db.SelectContext(ctx, &countries, query, args...)
+	if err != nil {
+		h.logger(c).Error("failed to get countries", "error", err)
+		return internalError(c, err)
+	}
+
+	var total int
+	err = h.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM country"+b.whereClause(), b.args...)
+	if err != nil {
+		h.logger(c).Error("failed to count countries", "error", err)
+		return internalError(c, err)
+	}
+	setPaginationHeaders(c, total)
+
+	return respondJSON(c, http.StatusOK, countries)
+}
+
+// GetCountrySearchHandler は名前が q で始まる国を、人口の多い順に最大 autocompleteLimit 件返す
+// q が空なら空の配列を返す
+func (h *Handler) GetCountrySearchHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	q := c.QueryParam("q")
+	countries := []Country{}
+	if q == "" {
+		return respondJSON(c, http.StatusOK, countries)
+	}
+
+	// 英語名と翻訳名のどちらが q で始まっても候補にする
+	prefix := likeEscaper.Replace(q) + "%"
+	err := h.db.SelectContext(ctx, &countries, "SELECT "+localizedCountryColumns+" FROM country"+localizedCountryJoin+" WHERE country.Name LIKE ? OR t.Name LIKE ? ORDER BY country.Population DESC, Name ASC LIMIT ?", preferredLanguage(c), prefix, prefix, autocompleteLimit)
+	if err != nil {
+		h.logger(c).Error("failed to search countries", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, countries)
+}
+
+type ContinentRank struct {
+	Code       string `json:"code"  db:"Code"`
+	Name       string `json:"name"  db:"Name"`
+	Continent  string `json:"continent"  db:"Continent"`
+	Rank       int    `json:"rank"  db:"PopulationRank"`
+	Population int64  `json:"population"  db:"Population"`
+	Countries  int    `json:"countries"  db:"Countries"`
+}
+
+// preferredLanguage はAccept-Languageの中で最も優先度の高い言語の主タグを返す
+// 指定がない場合は空文字列を返し、国名は country テーブルの英語名にフォールバックする
+func preferredLanguage(c echo.Context) string {
+	language := ""
+	best := 0.0
+	for _, part := range strings.Split(c.Request().Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > best {
+			primary, _, _ := strings.Cut(tag, "-")
+			language = strings.ToLower(primary)
+			best = q
+		}
+	}
+	return language
+}
+
+func (h *Handler) GetCountryContinentRankHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	code := c.Param("code")
+
+	var rank ContinentRank
+	err := h.db.GetContext(ctx, &rank, `SELECT Code, COALESCE(t.Name, ranked.Name) AS Name, Continent, PopulationRank, Population, Countries FROM (
+		SELECT Code, Name, Continent, Population,
+			RANK() OVER (PARTITION BY Continent ORDER BY Population DESC) AS PopulationRank,
+			COUNT(*) OVER (PARTITION BY Continent) AS Countries
+		FROM country
+	) AS ranked
+	LEFT JOIN country_translation t ON t.CountryCode = ranked.Code AND t.Language = ?
+	WHERE Code = ?`, preferredLanguage(c), code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to get continent rank", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, rank)
+}
+
+type CountryCityCount struct {
+	Code   string `json:"code"  db:"Code"`
+	Name   string `json:"name"  db:"Name"`
+	Cities int    `json:"cities"  db:"Cities"`
+}
+
+func (h *Handler) GetCountryWithMostCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var country CountryCityCount
+	// 都市数が同じ国がある場合は国名順で先頭のものを返す
+	err := h.db.GetContext(ctx, &country, `SELECT country.Code, COALESCE(t.Name, country.Name) AS Name, COUNT(*) AS Cities
+		FROM city JOIN country ON city.CountryCode = country.Code
+		LEFT JOIN country_translation t ON t.CountryCode = country.Code AND t.Language = ?
+		GROUP BY country.Code, country.Name, t.Name
+		ORDER BY Cities DESC, country.Name ASC LIMIT 1`, preferredLanguage(c))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to get country with most cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, country)
+}
+
+type CountryLanguage struct {
+	CountryCode string  `json:"countryCode,omitempty"  db:"CountryCode"`
+	Language    string  `json:"language,omitempty"  db:"Language"`
+	IsOfficial  bool    `json:"isOfficial"  db:"IsOfficial"`
+	Percentage  float64 `json:"percentage"  db:"Percentage"`
+}
+
+func (h *Handler) GetCountryLanguagesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	code := c.Param("code")
+
+	var count int
+	err := h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM country WHERE Code=?", code)
+	if err != nil {
+		h.logger(c).Error("failed to get country data", "error", err)
+		return internalError(c, err)
+	}
+	if count == 0 {
+		return jsonError(c, http.StatusNotFound, "not found")
+	}
+
+	// IsOfficial は 'T' か 'F' のENUMなので、boolに変換して取得する
+	languages := []CountryLanguage{}
+	err = h.db.SelectContext(ctx, &languages, "SELECT CountryCode, Language, IsOfficial = 'T' AS IsOfficial, Percentage FROM countrylanguage WHERE CountryCode=? ORDER BY Percentage DESC, Language ASC", code)
+	if err != nil {
+		h.logger(c).Error("failed to get country languages", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, languages)
+}
+
+type CountryCity struct {
+	City
+	IsCapital bool `json:"isCapital"  db:"IsCapital"`
+}
+
+// GetCountryCitiesHandler は国の都市を名前順に返す。首都には isCapital を付ける
+// limit と offset でページングし、X-Total-Count と Link ヘッダーを付ける
+func (h *Handler) GetCountryCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	code := c.Param("code")
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	var count int
+	err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM country WHERE Code=?", code)
+	if err != nil {
+		h.logger(c).Error("failed to get country data", "error", err)
+		return internalError(c, err)
+	}
+	if count == 0 {
+		return jsonError(c, http.StatusNotFound, "not found")
+	}
+
+	var total int
+	err = h.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM city WHERE CountryCode = ?", code)
+	if err != nil {
+		h.logger(c).Error("failed to count country cities", "error", err)
+		return internalError(c, err)
+	}
+	setPaginationHeaders(c, total)
+
+	cities := []CountryCity{}
+	err = h.db.SelectContext(ctx, &cities, `SELECT city.*, country.Capital IS NOT NULL AND country.Capital = city.ID AS IsCapital
+		FROM city JOIN country ON city.CountryCode = country.Code
+		WHERE country.Code = ?
+		ORDER BY city.Name ASC, city.ID ASC LIMIT ? OFFSET ?`, code, limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get country cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
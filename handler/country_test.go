@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "no header", header: "", want: ""},
+		{name: "single language", header: "ja", want: "ja"},
+		{name: "region subtag is dropped", header: "ja-JP", want: "ja"},
+		{name: "upper case is folded", header: "FR-CA", want: "fr"},
+		{name: "first of equal weights", header: "de, fr", want: "de"},
+		{name: "highest q wins", header: "en;q=0.5, ja;q=0.9, fr;q=0.7", want: "ja"},
+		{name: "implicit q of 1", header: "en;q=0.8, ja", want: "ja"},
+		{name: "wildcard is ignored", header: "*, ja;q=0.5", want: "ja"},
+		{name: "only wildcard", header: "*", want: ""},
+		{name: "invalid q is skipped", header: "fr;q=abc, ja;q=0.1", want: "ja"},
+		{name: "zero q is never chosen", header: "ja;q=0", want: ""},
+		{name: "spaces around parts", header: "  en-US ; q=0.2 ,  ko ; q=0.4 ", want: "ko"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Language", tt.header)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			if got := preferredLanguage(c); got != tt.want {
+				t.Errorf("preferredLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// countryColumns は localizedCountryColumns で選ぶカラム
+var countryColumns = []string{"Code", "Name", "Continent", "Region", "SurfaceArea", "IndepYear", "Population", "LifeExpectancy", "GNP", "GNPOld", "LocalName", "GovernmentForm", "HeadOfState", "Capital", "Code2"}
+
+func TestGetCountryHandlerLocalizesName(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		language string
+		dbName   string
+	}{
+		// 翻訳があれば COALESCE で翻訳名が選ばれる
+		{name: "translated", header: "ja-JP,en;q=0.5", language: "ja", dbName: "日本"},
+		// 翻訳がなければ英語名にフォールバックする
+		{name: "untranslated", header: "xx", language: "xx", dbName: "Japan"},
+		{name: "no header", header: "", language: "", dbName: "Japan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			mock.ExpectQuery(`SELECT country\.Code, COALESCE\(t\.Name, country\.Name\) AS Name, .* FROM country LEFT JOIN country_translation t ON t\.CountryCode = country\.Code AND t\.Language = \? WHERE country\.Code=\?`).
+				WithArgs(tt.language, "JPN").
+				WillReturnRows(sqlmock.NewRows(countryColumns).
+					AddRow("JPN", tt.dbName, "Asia", "Eastern Asia", 377829.0, 1868, 126714000, 80.7, 3787042.0, 4192638.0, "Nihon/Nippon", "Constitutional Monarchy", "Akihito", 1532, "JP"))
+
+			e := echo.New()
+			e.GET("/countries/:code", h.GetCountryHandler)
+			req := httptest.NewRequest(http.MethodGet, "/countries/JPN", nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Language", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			body := decodeJSON(t, rec).(map[string]interface{})
+			if body["name"] != tt.dbName {
+				t.Errorf("name = %v, want %q", body["name"], tt.dbName)
+			}
+		})
+	}
+}
+
+func TestGetCountryContinentRankHandler(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`RANK\(\) OVER \(PARTITION BY Continent ORDER BY Population DESC\) AS PopulationRank`).
+		WithArgs("", "JPN").
+		WillReturnRows(sqlmock.NewRows([]string{"Code", "Name", "Continent", "PopulationRank", "Population", "Countries"}).
+			AddRow("JPN", "Japan", "Asia", 9, 126714000, 51))
+
+	e := echo.New()
+	e.GET("/countries/:code/continent-rank", h.GetCountryContinentRankHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/countries/JPN/continent-rank", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var rank ContinentRank
+	if err := json.Unmarshal(rec.Body.Bytes(), &rank); err != nil {
+		t.Fatal(err)
+	}
+	want := ContinentRank{Code: "JPN", Name: "Japan", Continent: "Asia", Rank: 9, Population: 126714000, Countries: 51}
+	if rank != want {
+		t.Errorf("rank = %+v, want %+v", rank, want)
+	}
+}
+
+func TestGetCountryContinentRankHandlerUnknownCode(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`RANK\(\) OVER`).
+		WithArgs("", "XXX").
+		WillReturnRows(sqlmock.NewRows([]string{"Code", "Name", "Continent", "PopulationRank", "Population", "Countries"}))
+
+	e := echo.New()
+	e.GET("/countries/:code/continent-rank", h.GetCountryContinentRankHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/countries/XXX/continent-rank", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body.String())
+	}
+}
+
+func TestGetCountryWithMostCitiesHandler(t *testing.T) {
+	h, mock := newMockHandler(t)
+	// 同数のときに国名順で決まるよう、ORDER BY に国名を含める
+	mock.ExpectQuery(`GROUP BY country\.Code, country\.Name, t\.Name\s+ORDER BY Cities DESC, country\.Name ASC LIMIT 1`).
+		WithArgs("").
+		WillReturnRows(sqlmock.NewRows([]string{"Code", "Name", "Cities"}).AddRow("CHN", "China", 363))
+
+	e := echo.New()
+	e.GET("/countries/most-cities", h.GetCountryWithMostCitiesHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/countries/most-cities", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var country CountryCityCount
+	if err := json.Unmarshal(rec.Body.Bytes(), &country); err != nil {
+		t.Fatal(err)
+	}
+	want := CountryCityCount{Code: "CHN", Name: "China", Cities: 363}
+	if country != want {
+		t.Errorf("country = %+v, want %+v", country, want)
+	}
+}
+
+func TestGetCountryWithMostCitiesHandlerNoCities(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`ORDER BY Cities DESC`).
+		WithArgs("").
+		WillReturnRows(sqlmock.NewRows([]string{"Code", "Name", "Cities"}))
+
+	e := echo.New()
+	e.GET("/countries/most-cities", h.GetCountryWithMostCitiesHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/countries/most-cities", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body.String())
+	}
+}
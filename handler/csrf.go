@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CSRFHeader はPOST/PATCH/DELETEのリクエストでCSRFトークンを送るヘッダー
+const CSRFHeader = "X-CSRF-Token"
+
+type CSRFTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// GetCSRFTokenHandler はCSRFトークンを返す
+// 別のオリジンで動くフロントエンドは _csrf Cookieを読めないので、ここから取得して CSRFHeader に付ける
+func GetCSRFTokenHandler(c echo.Context) error {
+	token, _ := c.Get(middleware.DefaultCSRFConfig.ContextKey).(string)
+	return respondJSON(c, http.StatusOK, CSRFTokenResponse{Token: token})
+}
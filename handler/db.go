@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dbTimeout は1つのリクエストの中でDBの操作に使える時間の上限
+const dbTimeout = 5 * time.Second
+
+// dbContext はリクエストのcontextから dbTimeout でタイムアウトするcontextを作る
+// クライアントが切断したときもDBの操作が中断される
+func dbContext(c echo.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request().Context(), dbTimeout)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+)
+
+// retryAfterSeconds は再試行可能なエラーで Retry-After に設定する秒数
+const retryAfterSeconds = 5
+
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Status    int    `json:"status"`
+	Retryable bool   `json:"retryable"`
+}
+
+// isRetryable は時間をおいて再試行すれば成功する可能性があるステータスかを返す
+// レート制限やDBなどの一時的な障害は再試行可能、リクエスト自体の誤り (400/404/409など) は再試行不可とする
+func isRetryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// mysqlErrDupEntry は一意制約に違反したときのMySQLのエラー番号
+const mysqlErrDupEntry = 1062
+
+// isDuplicateEntry は err が一意制約違反 (主キーやUNIQUEインデックスの重複) によるものかを返す
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDupEntry
+}
+
+// MySQLの正規表現 (ICU) に関するエラー番号の範囲
+// ER_REGEXP_INVALID_FLAG (3685) から ER_REGEXP_INVALID_CAPTURE_GROUP_NAME (3699) まで
+const (
+	mysqlErrRegexpFirst = 3685
+	mysqlErrRegexpLast  = 3699
+)
+
+// isRegexpError は err がMySQLが REGEXP のパターンを扱えなかったことによるものかを返す
+// GoのRE2では受け付けても、MySQLのICUでは不正なパターン (名前付きグループの (?P<n>...) など) がある
+func isRegexpError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number >= mysqlErrRegexpFirst && mysqlErr.Number <= mysqlErrRegexpLast
+}
+
+// jsonError はエラーを {"error": msg, "status": status, "retryable": ...} の形式で返す
+// 再試行可能なエラーには Retry-After ヘッダーも付ける
+func jsonError(c echo.Context, status int, msg string) error {
+	retryable := isRetryable(status)
+	if retryable {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(status)
+	}
+	return c.JSON(status, ErrorResponse{Error: msg, Status: status, Retryable: retryable})
+}
+
+// bodyError はリクエストボディを読めなかったときのエラーを返す
+// Content-Length のないボディは読み込みの途中で上限を超えたことが分かり、
+// そのエラーは c.Bind やCSVの読み込みから返るので、ここで413に変換する
+func bodyError(c echo.Context, err error, msg string) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, echo.ErrStatusRequestEntityTooLarge) || errors.As(err, &maxBytesErr) {
+		return jsonError(c, http.StatusRequestEntityTooLarge, "request body too large")
+	}
+	return jsonError(c, http.StatusBadRequest, msg)
+}
+
+// isUnavailable は err がDBに接続できない・接続が切れたなどの一時的な障害によるものかを返す
+func isUnavailable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// internalError はサーバー側の原因で処理できなかったときのエラーを返す
+// DBの操作のタイムアウトやDBに接続できない場合は再試行可能な503、それ以外は500を返す
+func internalError(c echo.Context, err error) error {
+	if isUnavailable(err) {
+		return jsonError(c, http.StatusServiceUnavailable, "service unavailable")
+	}
+	return jsonError(c, http.StatusInternalServerError, "internal server error")
+}
+
+// ErrorHandler はハンドラーが返したエラー (ルートが見つからない場合など) を jsonError と同じ形式で返す
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	message := http.StatusText(status)
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Code
+		message = http.StatusText(status)
+		if m, ok := he.Message.(string); ok {
+			message = m
+		}
+	} else {
+		withRequest(slog.Default(), c).Error("unhandled error", "error", err)
+	}
+
+	err = jsonError(c, status, message)
+	if err != nil {
+		withRequest(slog.Default(), c).Error("failed to write error response", "error", err)
+	}
+}
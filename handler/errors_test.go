@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/labstack/echo/v4"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{status: http.StatusBadRequest, want: false},
+		{status: http.StatusUnauthorized, want: false},
+		{status: http.StatusForbidden, want: false},
+		{status: http.StatusNotFound, want: false},
+		{status: http.StatusConflict, want: false},
+		{status: http.StatusRequestEntityTooLarge, want: false},
+		{status: http.StatusTooManyRequests, want: true},
+		{status: http.StatusInternalServerError, want: false},
+		{status: http.StatusBadGateway, want: true},
+		{status: http.StatusServiceUnavailable, want: true},
+		{status: http.StatusGatewayTimeout, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			if got := isRetryable(tt.status); got != tt.want {
+				t.Fatalf("isRetryable(%d) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONError(t *testing.T) {
+	tests := []struct {
+		method         string
+		status         int
+		wantRetryAfter bool
+	}{
+		{method: http.MethodGet, status: http.StatusBadRequest, wantRetryAfter: false},
+		{method: http.MethodGet, status: http.StatusNotFound, wantRetryAfter: false},
+		{method: http.MethodGet, status: http.StatusInternalServerError, wantRetryAfter: false},
+		{method: http.MethodGet, status: http.StatusTooManyRequests, wantRetryAfter: true},
+		{method: http.MethodGet, status: http.StatusServiceUnavailable, wantRetryAfter: true},
+		{method: http.MethodHead, status: http.StatusNotFound, wantRetryAfter: false},
+		{method: http.MethodHead, status: http.StatusServiceUnavailable, wantRetryAfter: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d", tt.method, tt.status), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(tt.method, "/", nil), rec)
+
+			err := jsonError(c, tt.status, "message")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			retryAfter := rec.Header().Get("Retry-After")
+			if tt.wantRetryAfter && retryAfter != strconv.Itoa(retryAfterSeconds) {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, strconv.Itoa(retryAfterSeconds))
+			}
+			if !tt.wantRetryAfter && retryAfter != "" {
+				t.Errorf("Retry-After = %q, want empty", retryAfter)
+			}
+
+			// HEADのレスポンスにはボディを付けない
+			if tt.method == http.MethodHead {
+				if rec.Body.Len() != 0 {
+					t.Errorf("HEAD response has a body: %q", rec.Body.String())
+				}
+				return
+			}
+			var res ErrorResponse
+			err = json.Unmarshal(rec.Body.Bytes(), &res)
+			if err != nil {
+				t.Fatalf("body is not JSON: %q", rec.Body.String())
+			}
+			want := ErrorResponse{Error: "message", Status: tt.status, Retryable: tt.wantRetryAfter}
+			if res != want {
+				t.Errorf("body = %+v, want %+v", res, want)
+			}
+		})
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "deadline exceeded", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: http.StatusServiceUnavailable},
+		{name: "bad connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: http.StatusServiceUnavailable},
+		{name: "invalid connection", err: fmt.Errorf("query: %w", mysql.ErrInvalidConn), want: http.StatusServiceUnavailable},
+		{name: "dial error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, want: http.StatusServiceUnavailable},
+		{name: "connection refused", err: fmt.Errorf("connect: %w", syscall.ECONNREFUSED), want: http.StatusServiceUnavailable},
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: mysqlErrDupEntry}, want: http.StatusInternalServerError},
+		{name: "other error", err: errors.New("something broke"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			err := internalError(c, tt.err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			var res ErrorResponse
+			err = json.Unmarshal(rec.Body.Bytes(), &res)
+			if err != nil {
+				t.Fatalf("body is not JSON: %q", rec.Body.String())
+			}
+			if wantRetryable := tt.want == http.StatusServiceUnavailable; res.Retryable != wantRetryable {
+				t.Errorf("retryable = %v, want %v", res.Retryable, wantRetryable)
+			}
+		})
+	}
+}
+
+func TestBodyLimitWithoutContentLength(t *testing.T) {
+	// DBに触る前にボディの読み込みで失敗するので、db は nil のままでよい
+	h := &Handler{}
+	e := echo.New()
+	e.Use(BodyLimitMiddleware(1024))
+	e.POST("/cities/bulk", h.PostCitiesBulkHandler)
+	e.POST("/cities/import", h.PostCitiesImportHandler)
+
+	largeJSON := "[" + strings.Repeat(`{"name": "Tokyo", "countryCode": "JPN"},`, 10000) + `{"name": "Tokyo", "countryCode": "JPN"}]`
+	largeCSV := "Name,CountryCode,District,Population\n" + strings.Repeat("Tokyo,JPN,Tokyo-to,100\n", 10000)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "json over limit", target: "/cities/bulk", contentType: echo.MIMEApplicationJSON, body: largeJSON, want: http.StatusRequestEntityTooLarge},
+		{name: "malformed json", target: "/cities/bulk", contentType: echo.MIMEApplicationJSON, body: "[", want: http.StatusBadRequest},
+		{name: "json with content length over limit", target: "/cities/bulk", contentType: echo.MIMEApplicationJSON, body: largeJSON, want: http.StatusRequestEntityTooLarge},
+		{name: "csv over limit", target: "/cities/import", contentType: "text/csv", body: largeCSV, want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			// チャンク転送のように、ボディの大きさを事前に知らせない
+			req.ContentLength = -1
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
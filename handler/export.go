@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportFlushRows はCSVの書き出しで、この行数ごとにクライアントへ送り出す
+const exportFlushRows = 1000
+
+// GetCitiesExportHandler は都市をCSVでダウンロードさせる
+// countryCode を指定するとその国の都市だけを返す。列は取り込みと同じ Name,CountryCode,District,Population
+// 結果をメモリに溜めないよう、DBから1行読むごとにそのまま書き出す
+func (h *Handler) GetCitiesExportHandler(c echo.Context) error {
+	// 大きな書き出しは dbTimeout に収まらないので、リクエスト全体のタイムアウトに任せる
+	// REQUEST_TIMEOUT_OVERRIDES で /cities/export のタイムアウトを延ばせる
+	ctx := c.Request().Context()
+
+	b := queryBuilder{}
+	if countryCode := c.QueryParam("countryCode"); countryCode != "" {
+		b.where("CountryCode = ?", countryCode)
+	}
+	rows, err := h.db.QueryxContext(ctx, "SELECT Name, CountryCode, District, Population FROM city"+b.whereClause()+" ORDER BY ID ASC", b.args...)
+	if err != nil {
+		h.logger(c).Error("failed to export cities", "error", err)
+		return internalError(c, err)
+	}
+	defer rows.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="cities.csv"`)
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	w.Write(cityImportColumns)
+
+	// ヘッダーを送った後はステータスを変えられないので、途中で失敗したらログに残して打ち切る
+	n := 0
+	for rows.Next() {
+		var city City
+		err = rows.StructScan(&city)
+		if err != nil {
+			h.logger(c).Error("failed to scan city", "error", err)
+			return nil
+		}
+		// NULLの項目は空欄にする
+		population := ""
+		if city.Population.Valid {
+			population = strconv.FormatInt(city.Population.Int64, 10)
+		}
+		w.Write([]string{city.Name.String, city.CountryCode.String, city.District.String, population})
+
+		n++
+		if n%exportFlushRows == 0 {
+			w.Flush()
+			res.Flush()
+		}
+	}
+	if err = rows.Err(); err != nil {
+		h.logger(c).Error("failed to read cities", "error", err)
+	}
+
+	w.Flush()
+	if err = w.Error(); err != nil {
+		h.logger(c).Error("failed to write csv", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PostFavoriteHandler はログイン中のユーザーのお気に入りに都市を追加する
+// 既にお気に入りに入っている場合も204 No Contentを返す
+func (h *Handler) PostFavoriteHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	cityID, err := strconv.Atoi(c.Param("cityId"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "cityId must be an integer")
+	}
+
+	var count int
+	err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM city WHERE ID = ?", cityID)
+	if err != nil {
+		h.logger(c).Error("failed to get city", "error", err)
+		return internalError(c, err)
+	}
+	if count == 0 {
+		return jsonError(c, http.StatusNotFound, "not found")
+	}
+
+	// (Username, CityID) が主キーなので、2回目以降の追加は無視される
+	_, err = h.db.ExecContext(ctx, "INSERT IGNORE INTO user_favorites (Username, CityID) VALUES (?, ?)", c.Get("userName").(string), cityID)
+	if err != nil {
+		h.logger(c).Error("failed to add favorite", "error", err)
+		return internalError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteFavoriteHandler はログイン中のユーザーのお気に入りから都市を外す
+// お気に入りに入っていなくても204 No Contentを返す
+func (h *Handler) DeleteFavoriteHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	cityID, err := strconv.Atoi(c.Param("cityId"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "cityId must be an integer")
+	}
+
+	_, err = h.db.ExecContext(ctx, "DELETE FROM user_favorites WHERE Username = ? AND CityID = ?", c.Get("userName").(string), cityID)
+	if err != nil {
+		h.logger(c).Error("failed to delete favorite", "error", err)
+		return internalError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetFavoritesHandler はログイン中のユーザーのお気に入りの都市を、追加した順が新しいものから返す
+func (h *Handler) GetFavoritesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	cities := []City{}
+	err := h.db.SelectContext(ctx, &cities, `SELECT city.* FROM user_favorites
+		JOIN city ON city.ID = user_favorites.CityID
+		WHERE user_favorites.Username = ?
+		ORDER BY user_favorites.CreatedAt DESC, city.ID ASC`, c.Get("userName").(string))
+	if err != nil {
+		h.logger(c).Error("failed to get favorites", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
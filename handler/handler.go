@@ -3,21 +3,60 @@ package handler
 import (
 	"database/sql"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/naro-template-backend/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Handler struct {
-	db *sqlx.DB
+	db            *sqlx.DB
+	hub           *Hub
+	loginAttempts *loginLimiter
+
+	// UniqueCityPerDistrict がtrueなら、同じ国・地区に同名の都市を登録できなくする
+	UniqueCityPerDistrict bool
+	// AnomalyThreshold は人口の異常値とみなす、国内の平均からの標準偏差の倍数
+	AnomalyThreshold float64
+	// LoginMaxFailures と LoginFailureWindow は、LoginFailureWindow の間に
+	// LoginMaxFailures 回ログインに失敗したユーザー名・IPアドレスからのログインを拒否する設定
+	LoginMaxFailures   int
+	LoginFailureWindow time.Duration
+	// LoginRedirectAllowlist はフォームからのログイン後にリダイレクトしてよいパスの一覧
+	LoginRedirectAllowlist []string
+	// TokenSigningKey は GetMeTokenHandler が発行するJWTの署名に使う鍵
+	TokenSigningKey []byte
+	// Logger はハンドラーがログを出力する先。NewHandler は slog.Default() を設定する
+	Logger Logger
+	// BcryptCost はパスワードをハッシュ化するときのコスト
+	// bcrypt.MinCost から bcrypt.MaxCost の範囲で指定する
+	BcryptCost int
 }
 
-func NewHandler(db *sqlx.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *sqlx.DB, cfg config.Config) *Handler {
+	return &Handler{
+		db:                     db,
+		hub:                    NewHub(),
+		loginAttempts:          newLoginLimiter(),
+		Logger:                 slog.Default(),
+		UniqueCityPerDistrict:  cfg.UniqueCityPerDistrict,
+		AnomalyThreshold:       cfg.AnomalyThreshold,
+		LoginMaxFailures:       cfg.LoginMaxFailures,
+		LoginFailureWindow:     cfg.LoginFailureWindow,
+		LoginRedirectAllowlist: cfg.LoginRedirectAllowlist,
+		TokenSigningKey:        []byte(cfg.TokenSecret),
+		BcryptCost:             cfg.BcryptCost,
+	}
 }
 
 type City struct {
@@ -26,6 +65,8 @@ type City struct {
 	CountryCode sql.NullString `json:"countryCode,omitempty"  db:"CountryCode"`
 	District    sql.NullString `json:"district,omitempty"  db:"District"`
 	Population  sql.NullInt64  `json:"population,omitempty"  db:"Population"`
+	CreatedAt   sql.NullTime   `json:"createdAt,omitempty"  db:"CreatedAt"`
+	CreatedBy   sql.NullString `json:"createdBy,omitempty"  db:"CreatedBy"`
 }
 
 type CityInput struct {
@@ -36,155 +77,574 @@ type CityInput struct {
 	Population  int    `json:"population,omitempty"  db:"Population"`
 }
 
+// CityPatch は PATCH /cities/:id のリクエストボディ
+// 省略されたフィールドとゼロ値を区別するため、各フィールドをポインタで持つ
+type CityPatch struct {
+	Name        *string `json:"name"`
+	CountryCode *string `json:"countryCode"`
+	District    *string `json:"district"`
+	Population  *int    `json:"population"`
+}
+
+// empty は更新するフィールドが1つも指定されていないかを返す
+func (p CityPatch) empty() bool {
+	return p.Name == nil && p.CountryCode == nil && p.District == nil && p.Population == nil
+}
+
+// setClauses は指定されたフィールドだけを更新するUPDATEの SET 句と引数を返す
+func (p CityPatch) setClauses() ([]string, []interface{}) {
+	sets := []string{}
+	args := []interface{}{}
+	if p.Name != nil {
+		sets = append(sets, "Name = ?")
+		args = append(args, *p.Name)
+	}
+	if p.CountryCode != nil {
+		sets = append(sets, "CountryCode = ?")
+		args = append(args, *p.CountryCode)
+	}
+	if p.District != nil {
+		sets = append(sets, "District = ?")
+		args = append(args, *p.District)
+	}
+	if p.Population != nil {
+		sets = append(sets, "Population = ?")
+		args = append(args, *p.Population)
+	}
+	return sets, args
+}
+
+// apply は city に指定されたフィールドを上書きした結果を返す
+func (p CityPatch) apply(city CityInput) CityInput {
+	if p.Name != nil {
+		city.Name = *p.Name
+	}
+	if p.CountryCode != nil {
+		city.CountryCode = *p.CountryCode
+	}
+	if p.District != nil {
+		city.District = *p.District
+	}
+	if p.Population != nil {
+		city.Population = *p.Population
+	}
+	return city
+}
+
+// GetCityInfoHandler は名前が一致する都市を大文字小文字を区別せずに探して返す
+// 同じ名前の都市が複数ある場合 ("San Jose" など) は、IDが最も小さいものを返す
+// 全て取得したい場合は GetCitiesByNameHandler を使う
+//
+// GET /cities/:id は同じパスになるため、数字だけのときは名前ではなくIDとして扱う
 func (h *Handler) GetCityInfoHandler(c echo.Context) error {
 	cityName := c.Param("cityName")
+	if id, err := strconv.Atoi(cityName); err == nil {
+		return h.getCityByID(c, id)
+	}
+
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var city City
+	err := h.db.GetContext(ctx, &city, "SELECT * FROM city WHERE LOWER(Name)=LOWER(?) ORDER BY ID ASC LIMIT 1", cityName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to get city data", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, city)
+}
+
+// getCityByID はIDが一致する都市を返す
+// POST /cities が返すIDで、名前の重複を気にせずに都市を取得できる
+func (h *Handler) getCityByID(c echo.Context, id int) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
 
 	var city City
-	err := h.db.Get(&city, "SELECT * FROM city WHERE Name=?", cityName)
+	err := h.db.GetContext(ctx, &city, "SELECT * FROM city WHERE ID=?", id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return c.NoContent(http.StatusNotFound)
+			return jsonError(c, http.StatusNotFound, "not found")
 		}
-		log.Printf("failed to get city data: %s\n", err)
-		return c.NoContent(http.StatusInternalServerError)
+		h.logger(c).Error("failed to get city data", "error", err)
+		return internalError(c, err)
 	}
 
-	return c.JSON(http.StatusOK, city)
+	return respondJSON(c, http.StatusOK, city)
 }
 
 func (h *Handler) PostCityHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
 	var city CityInput
 	err := c.Bind(&city)
 	if err != nil {
-		log.Printf("test: %s\n", err)
-		return echo.NewHTTPError(http.StatusBadRequest, "bad request body")
+		h.logger(c).Debug("failed to bind city", "error", err)
+		return bodyError(c, err, "bad request body")
+	}
+
+	err = validateCityInput(city)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+	// 存在しない国コードの都市は登録しない
+	countries, err := h.existingCountryCodes(ctx, []string{city.CountryCode})
+	if err != nil {
+		h.logger(c).Error("failed to check country code", "error", err)
+		return internalError(c, err)
+	}
+	if !countries[city.CountryCode] {
+		return jsonError(c, http.StatusBadRequest, "countryCode does not exist")
+	}
+
+	if h.UniqueCityPerDistrict {
+		var count int
+		err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM city WHERE Name = ? AND CountryCode = ? AND District = ?", city.Name, city.CountryCode, city.District)
+		if err != nil {
+			h.logger(c).Error("failed to check duplicate city", "error", err)
+			return internalError(c, err)
+		}
+		if count > 0 {
+			return jsonError(c, http.StatusConflict, "City already exists in the district")
+		}
+	}
+
+	// 都市の登録と人口の履歴の記録をまとめて行う
+	err = h.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, "INSERT INTO city (Name, CountryCode, District, Population, CreatedBy) VALUES (?, ?, ?, ?, ?)", city.Name, city.CountryCode, city.District, city.Population, c.Get("userName").(string))
+		if err != nil {
+			return fmt.Errorf("failed to insert city data: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert id: %w", err)
+		}
+
+		city.ID = int(id)
+
+		err = recordPopulationHistory(ctx, tx, city.ID, city.Population)
+		if err != nil {
+			return fmt.Errorf("failed to record population history: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger(c).Error("failed to create city", "error", err)
+		return internalError(c, err)
+	}
+
+	h.audit(c.Get("userName").(string), "create", cityTarget(city.ID))
+	h.hub.Publish("created", city)
+
+	return respondJSON(c, http.StatusCreated, city)
+}
+
+// UpdateCityHandler は指定されたフィールドだけを更新し、更新後の都市を返す
+// 省略されたフィールドは変更せず、0 や空文字列を指定した場合はその値で更新する
+func (h *Handler) UpdateCityHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "id must be an integer")
+	}
+
+	var patch CityPatch
+	err = c.Bind(&patch)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+	if patch.empty() {
+		return jsonError(c, http.StatusBadRequest, "no updatable fields")
+	}
+
+	// 更新前の都市を FOR UPDATE で読み、更新と人口の履歴の記録が終わるまで他の更新を待たせる
+	// 検証に失敗したときは invalid にメッセージを入れてトランザクションを取り消す
+	var invalid string
+	err = h.withTx(ctx, func(tx *sqlx.Tx) error {
+		var before City
+		err := tx.GetContext(ctx, &before, "SELECT * FROM city WHERE ID=? FOR UPDATE", id)
+		if err != nil {
+			return fmt.Errorf("failed to get city data: %w", err)
+		}
+
+		// 更新後の都市に対して、登録と同じ検証を行う
+		merged := patch.apply(CityInput{
+			ID:          id,
+			Name:        before.Name.String,
+			CountryCode: before.CountryCode.String,
+			District:    before.District.String,
+			Population:  int(before.Population.Int64),
+		})
+		err = validateCityInput(merged)
+		if err != nil {
+			invalid = err.Error()
+			return err
+		}
+		countries, err := h.existingCountryCodes(ctx, []string{merged.CountryCode})
+		if err != nil {
+			return fmt.Errorf("failed to check country code: %w", err)
+		}
+		if !countries[merged.CountryCode] {
+			invalid = "countryCode does not exist"
+			return errors.New(invalid)
+		}
+
+		// 指定されたカラムだけを書き換え、同時に別のカラムを更新したリクエストの結果を上書きしない
+		sets, args := patch.setClauses()
+		_, err = tx.ExecContext(ctx, "UPDATE city SET "+strings.Join(sets, ", ")+" WHERE ID=?", append(args, id)...)
+		if err != nil {
+			return fmt.Errorf("failed to update city data: %w", err)
+		}
+
+		if patch.Population != nil && (!before.Population.Valid || int64(merged.Population) != before.Population.Int64) {
+			err = recordPopulationHistory(ctx, tx, id, merged.Population)
+			if err != nil {
+				return fmt.Errorf("failed to record population history: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if invalid != "" {
+			return jsonError(c, http.StatusBadRequest, invalid)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to update city", "error", err)
+		return internalError(c, err)
+	}
+
+	var city City
+	err = h.db.GetContext(ctx, &city, "SELECT * FROM city WHERE ID=?", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to get city data", "error", err)
+		return internalError(c, err)
 	}
 
-	result, err := h.db.Exec("INSERT INTO city (Name, CountryCode, District, Population) VALUES (?, ?, ?, ?)", city.Name, city.CountryCode, city.District, city.Population)
+	h.audit(c.Get("userName").(string), "update", cityTarget(city.ID))
+	h.hub.Publish("updated", city)
+
+	return respondJSON(c, http.StatusOK, city)
+}
+
+// DeleteCityHandler は都市を削除する。その都市を参照する行も同じトランザクションで削除する
+func (h *Handler) DeleteCityHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		log.Printf("failed to insert city data: %s\n", err)
-		return c.NoContent(http.StatusInternalServerError)
+		return jsonError(c, http.StatusBadRequest, "id must be an integer")
 	}
 
-	id, err := result.LastInsertId()
+	// 都市と、その都市を参照する人口の履歴・位置情報・お気に入りをまとめて削除する
+	err = h.withTx(ctx, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM city WHERE ID=?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete city data: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+
+		for _, table := range []string{"city_population_history", "city_location", "user_favorites"} {
+			_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE CityID=?", id)
+			if err != nil {
+				return fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("failed to get last insert id: %s\n", err)
-		return c.NoContent(http.StatusInternalServerError)
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to delete city", "error", err)
+		return internalError(c, err)
 	}
 
-	city.ID = int(id)
+	h.audit(c.Get("userName").(string), "delete", cityTarget(id))
+	h.hub.Publish("deleted", CityInput{ID: id})
 
-	return c.JSON(http.StatusCreated, city)
+	return c.NoContent(http.StatusNoContent)
 }
 
 type LoginRequestBody struct {
 	Username string `json:"username,omitempty" form:"username"`
 	Password string `json:"password,omitempty" form:"password"`
+	// Redirect はフォームからのログインに成功したときのリダイレクト先
+	Redirect string `json:"-" form:"redirect"`
+	// Remember がtrueならセッションの有効期間を RememberSessionTimeout に延ばす
+	Remember bool `json:"remember,omitempty" form:"remember"`
+}
+
+// normalizeUsername はユーザー名の前後の空白を取り除き、小文字にそろえる
+// 登録とログインで同じ正規化をしないと、登録できたのにログインできないユーザーが出てしまう
+func normalizeUsername(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
 }
 
 func (h *Handler) SignUpHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
 	// リクエストを受け取り、reqに格納する
 	req := LoginRequestBody{}
 	err := c.Bind(&req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "bad request body")
+		return bodyError(c, err, "bad request body")
 	}
+	req.Username = normalizeUsername(req.Username)
 
 	// バリデーションする(PasswordかUsernameが空文字列の場合は400 BadRequestを返す)
 	if req.Password == "" || req.Username == "" {
-		return c.String(http.StatusBadRequest, "Username or Password is empty")
+		return jsonError(c, http.StatusBadRequest, "Username or Password is empty")
+	}
+
+	// パスワードの強度が足りなければ400 BadRequestを返す
+	err = validatePassword(req.Password)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
 	}
 
 	// 登録しようとしているユーザーが既にデータベース内に存在するかチェック
+	// Username の照合順序は大文字小文字を区別しないので、正規化する前に登録された "Alice" も "alice" と一致する
 	var count int
-	err = h.db.Get(&count, "SELECT COUNT(*) FROM users WHERE Username=?", req.Username)
+	err = h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE Username=?", req.Username)
 	if err != nil {
-		log.Println(err)
-		return c.NoContent(http.StatusInternalServerError)
+		h.logger(c).Error("failed to count users", "error", err)
+		return internalError(c, err)
 	}
 	// 存在したら409 Conflictを返す
 	if count > 0 {
-		return c.String(http.StatusConflict, "Username is already used")
+		return jsonError(c, http.StatusConflict, "Username is already used")
 	}
 
 	// パスワードをハッシュ化する
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.Password), h.BcryptCost)
 	// ハッシュ化に失敗したら500 InternalServerErrorを返す
 	if err != nil {
-		log.Println(err)
-		return c.NoContent(http.StatusInternalServerError)
+		h.logger(c).Error("failed to hash password", "error", err)
+		return internalError(c, err)
 	}
 
 	// ユーザーを登録する
-	_, err = h.db.Exec("INSERT INTO users (Username, HashedPass) VALUES (?, ?)", req.Username, hashedPass)
-	// 登録に失敗したら500 InternalServerErrorを返す
+	_, err = h.db.ExecContext(ctx, "INSERT INTO users (Username, HashedPass) VALUES (?, ?)", req.Username, hashedPass)
 	if err != nil {
-		log.Println(err)
-		return c.NoContent(http.StatusInternalServerError)
+		// 確認から登録までの間に同じユーザー名で登録されていたら409 Conflictを返す
+		if isDuplicateEntry(err) {
+			return jsonError(c, http.StatusConflict, "Username is already used")
+		}
+		// 登録に失敗したら500 InternalServerErrorを返す
+		h.logger(c).Error("failed to insert user", "error", err)
+		return internalError(c, err)
 	}
 	// 登録に成功したら201 Createdを返す
 	return c.NoContent(http.StatusCreated)
 }
 
 type User struct {
-	Username   string `json:"username,omitempty"  db:"Username"`
-	HashedPass string `json:"-"  db:"HashedPass"`
+	Username   string       `json:"username,omitempty"  db:"Username"`
+	HashedPass string       `json:"-"  db:"HashedPass"`
+	IsAdmin    bool         `json:"isAdmin"  db:"IsAdmin"`
+	CreatedAt  sql.NullTime `json:"createdAt,omitempty"  db:"CreatedAt"`
 }
 
 func (h *Handler) LoginHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
 	// リクエストを受け取り、reqに格納する
 	var req LoginRequestBody
 	err := c.Bind(&req)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "bad request body")
+		return bodyError(c, err, "bad request body")
 	}
+	req.Username = normalizeUsername(req.Username)
 
 	// バリデーションする(PasswordかUsernameが空文字列の場合は400 BadRequestを返す)
 	if req.Password == "" || req.Username == "" {
-		return c.String(http.StatusBadRequest, "Username or Password is empty")
+		return jsonError(c, http.StatusBadRequest, "Username or Password is empty")
+	}
+
+	// フォームからのログインでリダイレクト先が指定されていたら、許可されたパスかを確認する
+	// 任意のURLへのリダイレクト (オープンリダイレクト) を防ぐため、許可されていなければ400 BadRequestを返す
+	redirect := ""
+	if isFormRequest(c) && req.Redirect != "" {
+		if !slices.Contains(h.LoginRedirectAllowlist, req.Redirect) {
+			return jsonError(c, http.StatusBadRequest, "redirect target is not allowed")
+		}
+		redirect = req.Redirect
+	}
+
+	// ユーザー名かIPアドレスで失敗が続いていたら429 Too Many Requestsを返す
+	// 失敗を記録したりリセットしたりするたびに、残りの回数を X-RateLimit-* ヘッダーに反映する
+	userKey, ipKey := "user:"+req.Username, "ip:"+c.RealIP()
+	maxFailures, window := h.loginLimits()
+	h.setLoginRateLimitHeaders(c, userKey, ipKey)
+	if h.loginAttempts.blocked(maxFailures, window, userKey, ipKey) {
+		return jsonError(c, http.StatusTooManyRequests, "too many failed login attempts")
 	}
 
 	// データベースからユーザーを取得する
+	// 登録時と同じく大文字小文字を区別せずに探す
 	user := User{}
-	err = h.db.Get(&user, "SELECT * FROM users WHERE username=?", req.Username)
+	err = h.db.GetContext(ctx, &user, "SELECT * FROM users WHERE Username=?", req.Username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return c.NoContent(http.StatusUnauthorized)
+			h.loginAttempts.recordFailure(window, userKey, ipKey)
+			h.setLoginRateLimitHeaders(c, userKey, ipKey)
+			return jsonError(c, http.StatusUnauthorized, "unauthorized")
 		} else {
-			log.Println(err)
-			return c.NoContent(http.StatusInternalServerError)
+			h.logger(c).Error("failed to get user", "error", err)
+			return internalError(c, err)
 		}
 	}
 	// パスワードが一致しているかを確かめる
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPass), []byte(req.Password))
 	if err != nil {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return c.NoContent(http.StatusUnauthorized)
+			h.loginAttempts.recordFailure(window, userKey, ipKey)
+			h.setLoginRateLimitHeaders(c, userKey, ipKey)
+			return jsonError(c, http.StatusUnauthorized, "unauthorized")
 		} else {
-			return c.NoContent(http.StatusInternalServerError)
+			return internalError(c, err)
 		}
 	}
+	// ログインに成功したらユーザー名の失敗回数をリセットする
+	h.loginAttempts.reset(userKey)
+	h.setLoginRateLimitHeaders(c, userKey, ipKey)
+
 	// セッションストアに登録する
 	sess, err := session.Get("sessions", c)
 	if err != nil {
-		log.Println(err)
-		return c.String(http.StatusInternalServerError, "something wrong in getting session")
+		h.logger(c).Error("failed to get session", "error", err)
+		return jsonError(c, http.StatusInternalServerError, "something wrong in getting session")
 	}
-	sess.Values["userName"] = req.Username
+	sess.Values["userName"] = user.Username
+	sess.Values["remember"] = req.Remember
+	sess.Options.MaxAge = int(sessionTimeout(sess) / time.Second)
 	sess.Save(c.Request(), c.Response())
 
+	// フォームからのログインなら302 Foundでリダイレクトする
+	if redirect != "" {
+		return c.Redirect(http.StatusFound, redirect)
+	}
+
+	// ログインしたユーザーの情報を返す (HashedPass はJSONに含めない)
+	return respondJSON(c, http.StatusOK, user)
+}
+
+// isFormRequest はリクエストがHTMLフォームから送信されたものかを返す
+func isFormRequest(c echo.Context) bool {
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	return strings.HasPrefix(contentType, echo.MIMEApplicationForm) || strings.HasPrefix(contentType, echo.MIMEMultipartForm)
+}
+
+// LogoutHandler はセッションからユーザー名を削除し、Cookieを失効させる
+// ログインしていなくても200 OKを返す
+func LogoutHandler(c echo.Context) error {
+	err := clearSession(c)
+	if err != nil {
+		withRequest(slog.Default(), c).Error("failed to clear session", "error", err)
+		return jsonError(c, http.StatusInternalServerError, "something wrong in clearing session")
+	}
+
 	return c.NoContent(http.StatusOK)
 }
 
+// clearSession はセッションからユーザー名を削除し、Cookieを失効させる
+func clearSession(c echo.Context) error {
+	sess, err := session.Get("sessions", c)
+	if err != nil {
+		return err
+	}
+	delete(sess.Values, "userName")
+	sess.Options.MaxAge = -1
+	return sess.Save(c.Request(), c.Response())
+}
+
+// DeleteMeHandler はログイン中のユーザーを削除してログアウトさせる
+// 既に削除されていても204 No Contentを返す
+func (h *Handler) DeleteMeHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	// ユーザーとそのお気に入りをまとめて削除する
+	userName := c.Get("userName").(string)
+	err := h.withTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM user_favorites WHERE Username=?", userName)
+		if err != nil {
+			return fmt.Errorf("failed to delete favorites: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE Username=?", userName)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger(c).Error("failed to delete user", "error", err)
+		return internalError(c, err)
+	}
+
+	err = clearSession(c)
+	if err != nil {
+		h.logger(c).Error("failed to clear session", "error", err)
+		return jsonError(c, http.StatusInternalServerError, "something wrong in clearing session")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SessionTimeout はセッションの有効期間
+// 最後にログインが必要なAPIを呼んでからこの時間が経つとセッションが切れる
+const SessionTimeout = 24 * time.Hour
+
+// RememberSessionTimeout は「ログインしたままにする」を選んだときのセッションの有効期間
+const RememberSessionTimeout = 30 * 24 * time.Hour
+
+// sessionTimeout はログイン時に選んだセッションの有効期間を返す
+func sessionTimeout(sess *sessions.Session) time.Duration {
+	if remember, _ := sess.Values["remember"].(bool); remember {
+		return RememberSessionTimeout
+	}
+	return SessionTimeout
+}
+
+// UserAuthMiddleware はログインしていないリクエストを401で拒否する
+// 期限切れのセッションはログインしていないものとして扱う
+// ログイン中のリクエストではセッションを保存し直して、有効期限を延長する
 func UserAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		sess, err := session.Get("sessions", c)
 		if err != nil {
-			log.Println(err)
-			return c.String(http.StatusInternalServerError, "something wrong in getting session")
+			withRequest(slog.Default(), c).Error("failed to get session", "error", err)
+			return jsonError(c, http.StatusInternalServerError, "something wrong in getting session")
 		}
 		if sess.Values["userName"] == nil {
-			return c.String(http.StatusUnauthorized, "please login")
+			return jsonError(c, http.StatusUnauthorized, "please login")
+		}
+		sess.Options.MaxAge = int(sessionTimeout(sess) / time.Second)
+		err = sess.Save(c.Request(), c.Response())
+		if err != nil {
+			withRequest(slog.Default(), c).Warn("failed to renew session", "error", err)
 		}
 		c.Set("userName", sess.Values["userName"].(string))
 		return next(c)
@@ -192,100 +652,137 @@ func UserAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 }
 
 type Me struct {
-	Username string `json:"username,omitempty"  db:"username"`
+	Username      string       `json:"username,omitempty"  db:"Username"`
+	CreatedAt     sql.NullTime `json:"createdAt,omitempty"  db:"CreatedAt"`
+	IsAdmin       bool         `json:"isAdmin"  db:"IsAdmin"`
+	FavoriteCount int          `json:"favoriteCount"  db:"FavoriteCount"`
 }
 
-func GetMeHandler(c echo.Context) error {
-	return c.JSON(http.StatusOK, Me{
-		Username: c.Get("userName").(string),
-	})
+// GetMeHandler はログイン中のユーザーのプロフィールを返す
+// 登録日時は CreatedAt カラムを追加する前に登録したユーザーでは省略される
+func (h *Handler) GetMeHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	// UserAuthMiddleware を通さずに登録された場合でもpanicせず401を返す
+	userName, ok := c.Get("userName").(string)
+	if !ok || userName == "" {
+		return jsonError(c, http.StatusUnauthorized, "please login")
+	}
+
+	var me Me
+	err := h.db.GetContext(ctx, &me, `SELECT users.Username, users.CreatedAt, users.IsAdmin,
+			(SELECT COUNT(*) FROM user_favorites WHERE user_favorites.Username = users.Username) AS FavoriteCount
+		FROM users WHERE users.Username = ?`, userName)
+	if err != nil {
+		// セッションが残っていてもユーザーが削除されていればログインしていないものとして扱う
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusUnauthorized, "please login")
+		}
+		h.logger(c).Error("failed to get user", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, me)
+}
+
+// WorldList は一覧の1ページ分。Items は通常は名前の配列、detail=true のときは City の配列になる
+type WorldList[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
 }
 
 func (h *Handler) GetWorldHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
 	countryName := c.Param("countryName")
 	cityName := c.Param("cityName")
-	println("countryName : " + countryName)
-	println("cityName : " + cityName)
+	h.logger(c).Debug("get world", "countryName", countryName, "cityName", cityName)
 
 	var howManyCountries = 0
-	var country string
-	var countries []string
+	// 該当するものがなくても null ではなく空の配列を返す
+	countries := []string{}
 	var countryCode string
 	var howManyCities = 0
-	var cities []string
-	var city string
+	cities := []string{}
 	var cityInfo City
 
 	if countryName == "allCountries" {
-		err := h.db.Get(&howManyCountries, "select count(*) from country")
+		limit, offset, err := parsePagination(c)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return c.NoContent(http.StatusNotFound)
-			}
-			log.Printf("failed to get world data 1 : %s\n", err)
-			return c.NoContent(http.StatusInternalServerError)
+			return jsonError(c, http.StatusBadRequest, err.Error())
 		}
-		for i := 0; i < howManyCountries; i++ {
-			err := h.db.Get(&country, "select Name from country order by Name asc limit 1 offset ?", i)
-			if err != nil {
-				if errors.Is(err, sql.ErrNoRows) {
-					return c.NoContent(http.StatusNotFound)
-				}
-				log.Printf("failed to get world data 1 : %s\n", err)
-				return c.NoContent(http.StatusInternalServerError)
-			}
-			countries = append(countries, country)
+		language := preferredLanguage(c)
+		err = h.db.GetContext(ctx, &howManyCountries, "select count(*) from country")
+		if err != nil {
+			h.logger(c).Error("failed to get world data 1 ", "error", err)
+			return internalError(c, err)
 		}
-		return c.JSON(http.StatusOK, countries)
+		err = h.db.SelectContext(ctx, &countries, "select COALESCE(t.Name, country.Name) AS Name from country left join country_translation t on t.CountryCode = country.Code and t.Language = ? order by Name asc limit ? offset ?", language, limit, offset)
+		if err != nil {
+			h.logger(c).Error("failed to get world data 1 ", "error", err)
+			return internalError(c, err)
+		}
+		return respondJSON(c, http.StatusOK, WorldList[string]{Items: countries, Total: howManyCountries, Limit: limit, Offset: offset})
 	} else {
 		if cityName == "allCities" {
-			err := h.db.Get(&countryCode, "select Code from country where Name = ?", countryName)
+			limit, offset, err := parsePagination(c)
+			if err != nil {
+				return jsonError(c, http.StatusBadRequest, err.Error())
+			}
+			err = h.db.GetContext(ctx, &countryCode, "select Code from country where Name = ?", countryName)
 			if err != nil {
 				if errors.Is(err, sql.ErrNoRows) {
-					return c.NoContent(http.StatusNotFound)
+					return jsonError(c, http.StatusNotFound, "not found")
 				}
-				log.Printf("failed to get world data 2 : %s\n", err)
-				return c.NoContent(http.StatusInternalServerError)
+				h.logger(c).Error("failed to get world data 2 ", "error", err)
+				return internalError(c, err)
 			} else {
-				err := h.db.Get(&howManyCities, "select count(*) from city where CountryCode = ?", countryCode)
+				// 国が存在すれば、都市が1つもなくても200で空の配列を返す
+				// 404になるのは国が存在しないときだけ
+				err := h.db.GetContext(ctx, &howManyCities, "select count(*) from city where CountryCode = ?", countryCode)
 				if err != nil {
-					if errors.Is(err, sql.ErrNoRows) {
-						return c.NoContent(http.StatusNotFound)
-					}
-					log.Printf("failed to get world data here : %s\n", err)
-					return c.NoContent(http.StatusInternalServerError)
+					h.logger(c).Error("failed to get world data here ", "error", err)
+					return internalError(c, err)
 				}
-				for i := 0; i < howManyCities; i++ {
-					err := h.db.Get(&city, "select Name from city where CountryCode = ? order by Name asc limit 1 offset ?", countryCode, i)
+				// detail=true なら名前だけでなく都市の全ての情報を返す
+				if c.QueryParam("detail") == "true" {
+					details := []City{}
+					err = h.db.SelectContext(ctx, &details, "select * from city where CountryCode = ? order by Name asc, ID asc limit ? offset ?", countryCode, limit, offset)
 					if err != nil {
-						if errors.Is(err, sql.ErrNoRows) {
-							return c.NoContent(http.StatusNotFound)
-						}
-						log.Printf("failed to get world data 3 : %s\n", err)
-						return c.NoContent(http.StatusInternalServerError)
+						h.logger(c).Error("failed to get world data 3 ", "error", err)
+						return internalError(c, err)
 					}
-					cities = append(cities, city)
+					return respondJSON(c, http.StatusOK, WorldList[City]{Items: details, Total: howManyCities, Limit: limit, Offset: offset})
+				}
+				err = h.db.SelectContext(ctx, &cities, "select Name from city where CountryCode = ? order by Name asc limit ? offset ?", countryCode, limit, offset)
+				if err != nil {
+					h.logger(c).Error("failed to get world data 3 ", "error", err)
+					return internalError(c, err)
 				}
-				return c.JSON(http.StatusOK, cities)
+				return respondJSON(c, http.StatusOK, WorldList[string]{Items: cities, Total: howManyCities, Limit: limit, Offset: offset})
 			}
 		} else {
-			err := h.db.Get(&countryCode, "select Code from country where Name = ?", countryName)
+			err := h.db.GetContext(ctx, &countryCode, "select Code from country where Name = ?", countryName)
 			if err != nil {
 				if errors.Is(err, sql.ErrNoRows) {
-					return c.NoContent(http.StatusNotFound)
+					return jsonError(c, http.StatusNotFound, "not found")
 				}
-				log.Printf("failed to get world data 4 : %s\n", err)
-				return c.NoContent(http.StatusInternalServerError)
+				h.logger(c).Error("failed to get world data 4 ", "error", err)
+				return internalError(c, err)
 			} else {
-				err := h.db.Get(&cityInfo, "select * from city where CountryCode = ? AND Name = ?", countryCode, cityName)
+				err := h.db.GetContext(ctx, &cityInfo, "select * from city where CountryCode = ? AND Name = ?", countryCode, cityName)
 				if err != nil {
 					if errors.Is(err, sql.ErrNoRows) {
-						return c.NoContent(http.StatusNotFound)
+						return jsonError(c, http.StatusNotFound, "not found")
 					}
-					log.Printf("failed to get world data 5 : %s\n", err)
-					return c.NoContent(http.StatusInternalServerError)
+					h.logger(c).Error("failed to get world data 5 ", "error", err)
+					return internalError(c, err)
 				}
-				return c.JSON(http.StatusOK, cityInfo)
+				return respondJSON(c, http.StatusOK, cityInfo)
 			}
 		}
 	}
@@ -0,0 +1,658 @@
+package handler
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/naro-template-backend/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newMockHandler は sqlmock のDBを使う Handler を作る
+// テストの終わりに、設定した期待どおりにクエリが実行されたかを確認する
+func newMockHandler(t *testing.T) (*Handler, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	h := NewHandler(sqlx.NewDb(db, "mysql"), config.Config{BcryptCost: bcrypt.MinCost})
+	h.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return h, mock
+}
+
+// withUser は UserAuthMiddleware の代わりに、ログイン中のユーザーとして name を設定する
+func withUser(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("userName", name)
+			return next(c)
+		}
+	}
+}
+
+// serveJSON は method と target に body をJSONとして送り、レスポンスを返す
+func serveJSON(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetMeHandlerWithoutUserName(t *testing.T) {
+	// UserAuthMiddleware を通さずに登録し、userName が設定されていない状態を作る
+	// DBに触る前に401を返すので、db は nil のままでよい
+	h := &Handler{}
+	e := echo.New()
+	e.GET("/me", h.GetMeHandler)
+	e.GET("/me/blank", h.GetMeHandler, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("userName", "")
+			return next(c)
+		}
+	})
+	e.GET("/me/wrong-type", h.GetMeHandler, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("userName", 1)
+			return next(c)
+		}
+	})
+
+	for _, target := range []string{"/me", "/me/blank", "/me/wrong-type"} {
+		t.Run(target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			var res ErrorResponse
+			err := json.Unmarshal(rec.Body.Bytes(), &res)
+			if err != nil {
+				t.Fatalf("body is not JSON: %q", rec.Body.String())
+			}
+			if res.Error != "please login" {
+				t.Errorf("error = %q, want %q", res.Error, "please login")
+			}
+		})
+	}
+}
+
+func TestCityPatchApply(t *testing.T) {
+	base := CityInput{ID: 1, Name: "Tokyo", CountryCode: "JPN", District: "Tokyo-to", Population: 100}
+
+	tests := []struct {
+		name      string
+		body      string
+		wantEmpty bool
+		want      CityInput
+	}{
+		{name: "empty body", body: `{}`, wantEmpty: true, want: base},
+		{name: "unknown field only", body: `{"id": 2}`, wantEmpty: true, want: base},
+		{
+			name: "zero population",
+			body: `{"population": 0}`,
+			want: CityInput{ID: 1, Name: "Tokyo", CountryCode: "JPN", District: "Tokyo-to", Population: 0},
+		},
+		{
+			name: "clear district",
+			body: `{"district": ""}`,
+			want: CityInput{ID: 1, Name: "Tokyo", CountryCode: "JPN", District: "", Population: 100},
+		},
+		{
+			name: "all fields",
+			body: `{"name": "Osaka", "countryCode": "JPN", "district": "Osaka", "population": 200}`,
+			want: CityInput{ID: 1, Name: "Osaka", CountryCode: "JPN", District: "Osaka", Population: 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/cities/1", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var patch CityPatch
+			err := c.Bind(&patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := patch.empty(); got != tt.wantEmpty {
+				t.Errorf("empty() = %v, want %v", got, tt.wantEmpty)
+			}
+			if got := patch.apply(base); got != tt.want {
+				t.Errorf("apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateCityHandlerRejectsEmptyPatch(t *testing.T) {
+	// DBに触る前に400を返すので、db は nil のままでよい
+	h := &Handler{}
+	e := echo.New()
+	e.PATCH("/cities/:id", h.UpdateCityHandler)
+
+	for _, body := range []string{`{}`, `{"id": 2}`} {
+		t.Run(body, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/cities/1", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// cityColumns は SELECT * FROM city が返すカラム
+var cityColumns = []string{"ID", "Name", "CountryCode", "District", "Population", "CreatedAt", "CreatedBy"}
+
+func TestUpdateCityHandlerUpdatesOnlyPatchedColumns(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantUpdate string
+		wantArgs   []driver.Value
+		history    bool
+	}{
+		{
+			name:       "zero population",
+			body:       `{"population": 0}`,
+			wantUpdate: `UPDATE city SET Population = \? WHERE ID=\?`,
+			wantArgs:   []driver.Value{0, 1},
+			history:    true,
+		},
+		{
+			name:       "name and empty district",
+			body:       `{"name": "Edo", "district": ""}`,
+			wantUpdate: `UPDATE city SET Name = \?, District = \? WHERE ID=\?`,
+			wantArgs:   []driver.Value{"Edo", "", 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT \* FROM city WHERE ID=\? FOR UPDATE`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1, "Tokyo", "JPN", "Tokyo-to", 100, nil, nil))
+			mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+				WithArgs("JPN").
+				WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+			mock.ExpectExec(tt.wantUpdate).WithArgs(tt.wantArgs...).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.history {
+				mock.ExpectExec("INSERT INTO city_population_history").WithArgs(1, 0).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			mock.ExpectCommit()
+			mock.ExpectQuery(`SELECT \* FROM city WHERE ID=\?`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1, "Tokyo", "JPN", "Tokyo-to", 0, nil, nil))
+			mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+
+			e := echo.New()
+			e.PATCH("/cities/:id", h.UpdateCityHandler, withUser("alice"))
+			rec := serveJSON(e, http.MethodPatch, "/cities/1", tt.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateCityHandlerRejectsUnknownCountry(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM city WHERE ID=\? FOR UPDATE`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(1, "Tokyo", "JPN", "Tokyo-to", 100, nil, nil))
+	mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+		WithArgs("XXX").
+		WillReturnRows(sqlmock.NewRows([]string{"Code"}))
+	// UPDATE を実行せずに取り消す
+	mock.ExpectRollback()
+
+	e := echo.New()
+	e.PATCH("/cities/:id", h.UpdateCityHandler, withUser("alice"))
+	rec := serveJSON(e, http.MethodPatch, "/cities/1", `{"countryCode": "XXX"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if body := decodeJSON(t, rec).(map[string]interface{}); body["error"] != "countryCode does not exist" {
+		t.Errorf("error = %v, want %q", body["error"], "countryCode does not exist")
+	}
+}
+
+func TestPostCityHandlerRejectsUnknownCountry(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+		WithArgs("XXX").
+		WillReturnRows(sqlmock.NewRows([]string{"Code"}))
+
+	e := echo.New()
+	e.POST("/cities", h.PostCityHandler, withUser("alice"))
+	rec := serveJSON(e, http.MethodPost, "/cities", `{"name": "Nowhere", "countryCode": "XXX", "district": "", "population": 1}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if body := decodeJSON(t, rec).(map[string]interface{}); body["error"] != "countryCode does not exist" {
+		t.Errorf("error = %v, want %q", body["error"], "countryCode does not exist")
+	}
+}
+
+func TestPostCityHandlerUniquePerDistrict(t *testing.T) {
+	body := `{"name": "Tokyo", "countryCode": "JPN", "district": "Tokyo-to", "population": 100}`
+
+	tests := []struct {
+		name       string
+		unique     bool
+		existing   int
+		wantStatus int
+	}{
+		{name: "enforced duplicate", unique: true, existing: 1, wantStatus: http.StatusConflict},
+		{name: "enforced new", unique: true, existing: 0, wantStatus: http.StatusCreated},
+		// 無効なときは重複を確認せずに登録する
+		{name: "relaxed duplicate", unique: false, wantStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			h.UniqueCityPerDistrict = tt.unique
+			mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+				WithArgs("JPN").
+				WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+			if tt.unique {
+				mock.ExpectQuery(`SELECT COUNT\(\*\) FROM city WHERE Name = \? AND CountryCode = \? AND District = \?`).
+					WithArgs("Tokyo", "JPN", "Tokyo-to").
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(tt.existing))
+			}
+			if tt.wantStatus == http.StatusCreated {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO city ").
+					WithArgs("Tokyo", "JPN", "Tokyo-to", 100, "alice").
+					WillReturnResult(sqlmock.NewResult(10, 1))
+				mock.ExpectExec("INSERT INTO city_population_history").WithArgs(10, 100).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			e := echo.New()
+			e.POST("/cities", h.PostCityHandler, withUser("alice"))
+			rec := serveJSON(e, http.MethodPost, "/cities", body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSignUpHandlerRejectsCaseInsensitiveDuplicate(t *testing.T) {
+	// "Alice" は登録時に "alice" に正規化されて保存されている
+	for _, username := range []string{"alice", "ALICE", " Alice "} {
+		t.Run(username, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE Username=\?`).
+				WithArgs("alice").
+				WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+
+			e := echo.New()
+			e.POST("/signup", h.SignUpHandler)
+			rec := serveJSON(e, http.MethodPost, "/signup", `{"username": "`+username+`", "password": "password123"}`)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSignUpHandlerDuplicateEntryIsConflict(t *testing.T) {
+	// COUNT(*) の確認の後に別のリクエストが "Alice" を登録した場合
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE Username=\?`).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnError(&mysql.MySQLError{Number: mysqlErrDupEntry, Message: "Duplicate entry 'alice' for key 'PRIMARY'"})
+
+	e := echo.New()
+	e.POST("/signup", h.SignUpHandler)
+	rec := serveJSON(e, http.MethodPost, "/signup", `{"username": "alice", "password": "password123"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+}
+
+func TestSignUpHandlerConcurrentDuplicate(t *testing.T) {
+	// 2つのリクエストがどちらも COUNT(*) で0を見てから INSERT し、
+	// 後から INSERT した方が一意制約に違反する
+	h, mock := newMockHandler(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE Username=\?`).
+			WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	}
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnError(&mysql.MySQLError{Number: mysqlErrDupEntry, Message: "Duplicate entry 'alice' for key 'PRIMARY'"})
+
+	e := echo.New()
+	e.POST("/signup", h.SignUpHandler)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i, name := range []string{"alice", "Alice"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serveJSON(e, http.MethodPost, "/signup", `{"username": "`+name+`", "password": "password123"}`).Code
+		}()
+	}
+	wg.Wait()
+
+	sort.Ints(codes)
+	if want := []int{http.StatusCreated, http.StatusConflict}; codes[0] != want[0] || codes[1] != want[1] {
+		t.Fatalf("status codes = %v, want %v", codes, want)
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "alice", want: "alice"},
+		{input: "Alice", want: "alice"},
+		{input: " Alice ", want: "alice"},
+		{input: "\tALICE\n", want: "alice"},
+		{input: "Mary Ann", want: "mary ann"},
+		{input: "   ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := normalizeUsername(tt.input); got != tt.want {
+				t.Fatalf("normalizeUsername(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// capturedArg は sqlmock に渡された引数を記録し、どんな値にもマッチする
+type capturedArg struct {
+	value driver.Value
+}
+
+func (a *capturedArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+// userColumns は SELECT * FROM users が返すカラム
+var userColumns = []string{"Username", "HashedPass", "IsAdmin", "CreatedAt"}
+
+// newSessionEcho はCookieのセッションストアを使う echo.Echo を作る
+func newSessionEcho() *echo.Echo {
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("secret"))))
+	return e
+}
+
+func TestSignUpWithSpacesAndLogInWithLowerCase(t *testing.T) {
+	h, mock := newMockHandler(t)
+	e := newSessionEcho()
+	e.POST("/signup", h.SignUpHandler)
+	e.POST("/login", h.LoginHandler)
+
+	// " Alice " で登録すると "alice" として保存される
+	hashedPass := &capturedArg{}
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE Username=\?`).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("alice", hashedPass).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := serveJSON(e, http.MethodPost, "/signup", `{"username": " Alice ", "password": "password123"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("signup status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	// "alice" でログインすると、登録したユーザーが見つかる
+	mock.ExpectQuery(`SELECT \* FROM users WHERE Username=\?`).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("alice", hashedPass.value, false, nil))
+
+	rec = serveJSON(e, http.MethodPost, "/login", `{"username": "alice", "password": "password123"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if len(rec.Result().Cookies()) == 0 {
+		t.Error("login did not set a session cookie")
+	}
+}
+
+// serveForm はフォームのボディでリクエストを送る
+func serveForm(e *echo.Echo, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginHandlerFormRedirect(t *testing.T) {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("allowed redirect", func(t *testing.T) {
+		h, mock := newMockHandler(t)
+		h.LoginRedirectAllowlist = []string{"/dashboard"}
+		e := newSessionEcho()
+		e.POST("/login", h.LoginHandler)
+
+		mock.ExpectQuery(`SELECT \* FROM users WHERE Username=\?`).
+			WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows(userColumns).AddRow("alice", string(hashedPass), false, nil))
+
+		rec := serveForm(e, "/login", url.Values{"username": {"alice"}, "password": {"password123"}, "redirect": {"/dashboard"}})
+		if rec.Code != http.StatusFound {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusFound, rec.Body.String())
+		}
+		if got := rec.Header().Get(echo.HeaderLocation); got != "/dashboard" {
+			t.Errorf("Location = %q, want %q", got, "/dashboard")
+		}
+	})
+
+	// 許可されていないリダイレクト先はデータベースを見る前に拒否する
+	// newMockHandler は期待していないクエリが実行されると失敗する
+	for _, redirect := range []string{"https://evil.example.com/", "//evil.example.com", "/dashboard/../admin"} {
+		t.Run("rejected "+redirect, func(t *testing.T) {
+			h, _ := newMockHandler(t)
+			h.LoginRedirectAllowlist = []string{"/dashboard"}
+			e := newSessionEcho()
+			e.POST("/login", h.LoginHandler)
+
+			rec := serveForm(e, "/login", url.Values{"username": {"alice"}, "password": {"password123"}, "redirect": {redirect}})
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			if rec.Header().Get(echo.HeaderLocation) != "" {
+				t.Errorf("Location = %q, want none", rec.Header().Get(echo.HeaderLocation))
+			}
+			if len(rec.Result().Cookies()) != 0 {
+				t.Error("rejected login set a session cookie")
+			}
+		})
+	}
+}
+
+func TestDeleteMeThenLoginIsUnauthorized(t *testing.T) {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, mock := newMockHandler(t)
+	e := newSessionEcho()
+	e.POST("/login", h.LoginHandler)
+	e.DELETE("/me", h.DeleteMeHandler, UserAuthMiddleware)
+
+	mock.ExpectQuery(`SELECT \* FROM users WHERE Username=\?`).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("alice", string(hashedPass), false, nil))
+	rec := serveJSON(e, http.MethodPost, "/login", `{"username": "alice", "password": "password123"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	cookies := rec.Result().Cookies()
+
+	// ユーザーとお気に入りを削除し、セッションのCookieを期限切れにする
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM user_favorites WHERE Username=\?`).WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM users WHERE Username=\?`).WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	req := httptest.NewRequest(http.MethodDelete, "/me", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+	// UserAuthMiddleware が延長したCookieの後に、期限切れのCookieが設定される
+	var last *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "sessions" {
+			last = cookie
+		}
+	}
+	if last == nil || last.MaxAge >= 0 {
+		t.Errorf("last session cookie = %v, want expired", last)
+	}
+
+	// 削除したユーザーではログインできない
+	mock.ExpectQuery(`SELECT \* FROM users WHERE Username=\?`).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows(userColumns))
+	rec = serveJSON(e, http.MethodPost, "/login", `{"username": "alice", "password": "password123"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login after delete status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body.String())
+	}
+}
+
+func TestGetWorldHandlerCountryCities(t *testing.T) {
+	tests := []struct {
+		name       string
+		country    string
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantList   WorldList[string]
+	}{
+		{
+			name:    "country with cities",
+			country: "Japan",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`select Code from country where Name = \?`).
+					WithArgs("Japan").
+					WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+				mock.ExpectQuery(`select count\(\*\) from city where CountryCode = \?`).
+					WithArgs("JPN").
+					WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(2))
+				mock.ExpectQuery(`select Name from city where CountryCode = \? order by Name asc limit \? offset \?`).
+					WithArgs("JPN", defaultLimit, 0).
+					WillReturnRows(sqlmock.NewRows([]string{"Name"}).AddRow("Osaka").AddRow("Tokyo"))
+			},
+			wantStatus: http.StatusOK,
+			wantList:   WorldList[string]{Items: []string{"Osaka", "Tokyo"}, Total: 2, Limit: defaultLimit},
+		},
+		{
+			// 国が存在すれば都市がなくても200で空の配列を返す
+			name:    "country without cities",
+			country: "Antarctica",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`select Code from country where Name = \?`).
+					WithArgs("Antarctica").
+					WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("ATA"))
+				mock.ExpectQuery(`select count\(\*\) from city where CountryCode = \?`).
+					WithArgs("ATA").
+					WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+				mock.ExpectQuery(`select Name from city where CountryCode = \?`).
+					WithArgs("ATA", defaultLimit, 0).
+					WillReturnRows(sqlmock.NewRows([]string{"Name"}))
+			},
+			wantStatus: http.StatusOK,
+			wantList:   WorldList[string]{Items: []string{}, Total: 0, Limit: defaultLimit},
+		},
+		{
+			name:    "bogus country",
+			country: "Atlantis",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`select Code from country where Name = \?`).
+					WithArgs("Atlantis").
+					WillReturnRows(sqlmock.NewRows([]string{"Code"}))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			tt.expect(mock)
+
+			e := echo.New()
+			e.GET("/world/:countryName/:cityName", h.GetWorldHandler)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/world/"+tt.country+"/allCities", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var list WorldList[string]
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(list, tt.wantList) {
+				t.Errorf("list = %+v, want %+v", list, tt.wantList)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// hubClientBuffer は1クライアントあたりに溜めておけるメッセージの数
+// これを超えて受信が追いつかないクライアントは切断する
+const hubClientBuffer = 16
+
+type CityEvent struct {
+	Type string      `json:"type"`
+	City interface{} `json:"city"`
+}
+
+// Hub は都市の作成・更新・削除のイベントを接続中のWebSocketクライアントに配信する
+type Hub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: map[chan []byte]struct{}{}}
+}
+
+func (hub *Hub) subscribe() chan []byte {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	ch := make(chan []byte, hubClientBuffer)
+	hub.clients[ch] = struct{}{}
+	return ch
+}
+
+func (hub *Hub) unsubscribe(ch chan []byte) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, ok := hub.clients[ch]; ok {
+		delete(hub.clients, ch)
+		close(ch)
+	}
+}
+
+// Publish はイベントを全クライアントに送る
+// バッファが一杯のクライアントは待たずに切断する
+func (hub *Hub) Publish(eventType string, city interface{}) {
+	msg, err := json.Marshal(CityEvent{Type: eventType, City: city})
+	if err != nil {
+		slog.Error("failed to marshal city event", "error", err)
+		return
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.clients {
+		select {
+		case ch <- msg:
+		default:
+			delete(hub.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// CitiesWebSocketHandler は都市のイベントをWebSocketで配信する
+func (h *Handler) CitiesWebSocketHandler(c echo.Context) error {
+	websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		ch := h.hub.subscribe()
+		defer h.hub.unsubscribe(ch)
+
+		// クライアントからのメッセージは使わないが、切断を検知するために読み続ける
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var msg []byte
+			for websocket.Message.Receive(ws, &msg) == nil {
+			}
+		}()
+
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := websocket.Message.Send(ws, string(msg)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHubPublishFansOut(t *testing.T) {
+	hub := NewHub()
+	clients := []chan []byte{hub.subscribe(), hub.subscribe(), hub.subscribe()}
+
+	hub.Publish("create", map[string]string{"name": "Tokyo"})
+
+	for i, ch := range clients {
+		select {
+		case msg := <-ch:
+			var event struct {
+				Type string            `json:"type"`
+				City map[string]string `json:"city"`
+			}
+			if err := json.Unmarshal(msg, &event); err != nil {
+				t.Fatalf("client %d: failed to decode event: %v", i, err)
+			}
+			if event.Type != "create" || event.City["name"] != "Tokyo" {
+				t.Errorf("client %d: event = %+v", i, event)
+			}
+		default:
+			t.Errorf("client %d did not receive the event", i)
+		}
+	}
+}
+
+func TestHubPublishDropsSlowClient(t *testing.T) {
+	hub := NewHub()
+	slow := hub.subscribe()
+	fast := hub.subscribe()
+
+	// fast は毎回読み出し、slow は一切読まない
+	for i := 0; i < hubClientBuffer+1; i++ {
+		hub.Publish("update", i)
+		select {
+		case <-fast:
+		default:
+			t.Fatalf("fast client missed event %d", i)
+		}
+	}
+
+	// バッファ分のメッセージを読み切ると、切断されてチャネルが閉じている
+	for i := 0; i < hubClientBuffer; i++ {
+		if _, ok := <-slow; !ok {
+			t.Fatalf("slow client was closed after %d messages, want %d", i, hubClientBuffer)
+		}
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("slow client is still subscribed after its buffer filled up")
+	}
+
+	hub.mu.Lock()
+	_, slowSubscribed := hub.clients[slow]
+	_, fastSubscribed := hub.clients[fast]
+	hub.mu.Unlock()
+	if slowSubscribed {
+		t.Error("slow client was not removed from the hub")
+	}
+	if !fastSubscribed {
+		t.Error("fast client was removed from the hub")
+	}
+
+	// 切断済みのクライアントの unsubscribe は二重に close しない
+	hub.unsubscribe(slow)
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// cityImportColumns はCSVの取り込みで1行目に必要な列名
+var cityImportColumns = []string{"Name", "CountryCode", "District", "Population"}
+
+type CityImportSkip struct {
+	// Line はCSVの行番号 (ヘッダーを1行目とする)
+	Line   int      `json:"line"`
+	Errors []string `json:"errors"`
+}
+
+type CityImportResponse struct {
+	Inserted int              `json:"inserted"`
+	IDs      []int            `json:"ids"`
+	Skipped  []CityImportSkip `json:"skipped"`
+}
+
+// PostCitiesImportHandler はCSVで送られた都市を1つのトランザクションでまとめて登録する
+// 1行目は Name,CountryCode,District,Population のヘッダーとする
+// 一括登録と同じ検証を行い、失敗した行は行番号と理由を付けて飛ばし、残りの行だけを登録する
+func (h *Handler) PostCitiesImportHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != "text/csv" {
+		return jsonError(c, http.StatusUnsupportedMediaType, "Content-Type must be text/csv")
+	}
+
+	// 列の数が違う行も全体を止めずに飛ばせるよう、列の数は自分で確認する
+	r := csv.NewReader(c.Request().Body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return jsonError(c, http.StatusBadRequest, "no cities")
+		}
+		return bodyError(c, err, "bad csv: "+err.Error())
+	}
+	if len(header) != len(cityImportColumns) {
+		return jsonError(c, http.StatusBadRequest, "header must be "+strings.Join(cityImportColumns, ","))
+	}
+	for i, column := range cityImportColumns {
+		if !strings.EqualFold(strings.TrimSpace(header[i]), column) {
+			return jsonError(c, http.StatusBadRequest, "header must be "+strings.Join(cityImportColumns, ","))
+		}
+	}
+
+	// 読み込んだ行と、その行番号を対応させて持っておく
+	var cities []CityInput
+	var lines []int
+	skipped := []CityImportSkip{}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return bodyError(c, err, "bad csv: "+err.Error())
+		}
+		line, _ := r.FieldPos(0)
+		if len(cities)+len(skipped) >= maxBulkCities {
+			return jsonError(c, http.StatusBadRequest, "too many cities (max "+strconv.Itoa(maxBulkCities)+")")
+		}
+
+		if len(record) != len(cityImportColumns) {
+			msg := "expected " + strconv.Itoa(len(cityImportColumns)) + " fields, got " + strconv.Itoa(len(record))
+			skipped = append(skipped, CityImportSkip{Line: line, Errors: []string{msg}})
+			continue
+		}
+		population, err := strconv.Atoi(strings.TrimSpace(record[3]))
+		if err != nil {
+			skipped = append(skipped, CityImportSkip{Line: line, Errors: []string{"population must be an integer"}})
+			continue
+		}
+		cities = append(cities, CityInput{
+			Name:        record[0],
+			CountryCode: record[1],
+			District:    record[2],
+			Population:  population,
+		})
+		lines = append(lines, line)
+	}
+	if len(cities) == 0 && len(skipped) == 0 {
+		return jsonError(c, http.StatusBadRequest, "no cities")
+	}
+
+	results, err := h.validateCities(ctx, cities)
+	if err != nil {
+		h.logger(c).Error("failed to validate cities", "error", err)
+		return internalError(c, err)
+	}
+	valid := []CityInput{}
+	for i, result := range results {
+		if !result.Valid {
+			skipped = append(skipped, CityImportSkip{Line: lines[i], Errors: result.Errors})
+			continue
+		}
+		valid = append(valid, cities[i])
+	}
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Line < skipped[j].Line })
+
+	res := CityImportResponse{IDs: []int{}, Skipped: skipped}
+	if len(valid) > 0 {
+		userName := c.Get("userName").(string)
+		err = h.withTx(ctx, func(tx *sqlx.Tx) error {
+			res.IDs, err = insertCities(ctx, tx, valid, userName)
+			return err
+		})
+		if err != nil {
+			h.logger(c).Error("failed to import cities", "error", err)
+			return internalError(c, err)
+		}
+		h.auditCities(userName, "create", res.IDs)
+	}
+	res.Inserted = len(res.IDs)
+
+	for i, city := range valid {
+		city.ID = res.IDs[i]
+		h.hub.Publish("created", city)
+	}
+
+	return respondJSON(c, http.StatusOK, res)
+}
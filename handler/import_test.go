@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+// serveCSV はCSVのボディでリクエストを送る
+func serveCSV(e *echo.Echo, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPostCitiesImportHandlerSkipsWrongFieldCount(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+		WithArgs("JPN", "JPN").
+		WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO city ").WithArgs("Tokyo", "JPN", "Tokyo-to", 100, "alice").WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("INSERT INTO city ").WithArgs("Kyoto", "JPN", "Kyoto", 300, "alice").WillReturnResult(sqlmock.NewResult(11, 1))
+	mock.ExpectExec("INSERT INTO city_population_history").WithArgs(10, 100, 11, 300).WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(1, 2))
+
+	e := echo.New()
+	e.POST("/cities/import", h.PostCitiesImportHandler, withUser("alice"))
+	rec := serveCSV(e, "/cities/import", strings.Join([]string{
+		"Name,CountryCode,District,Population",
+		"Tokyo,JPN,Tokyo-to,100",
+		"Osaka,JPN,Osaka",
+		"Nagoya,JPN,Aichi,200,extra",
+		"Kyoto,JPN,Kyoto,300",
+		"Sapporo,JPN,Hokkaido,many",
+	}, "\n")+"\n")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var res CityImportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	want := CityImportResponse{
+		Inserted: 2,
+		IDs:      []int{10, 11},
+		Skipped: []CityImportSkip{
+			{Line: 3, Errors: []string{"expected 4 fields, got 3"}},
+			{Line: 4, Errors: []string{"expected 4 fields, got 5"}},
+			{Line: 6, Errors: []string{"population must be an integer"}},
+		},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("response = %+v, want %+v", res, want)
+	}
+}
+
+func TestPostCitiesImportHandlerRejectsBadHeader(t *testing.T) {
+	// DBに触る前に400を返す
+	h, _ := newMockHandler(t)
+	e := echo.New()
+	e.POST("/cities/import", h.PostCitiesImportHandler, withUser("alice"))
+
+	for _, header := range []string{"Name,CountryCode,District", "Name,CountryCode,District,Population,Extra", "Name,Code,District,Population"} {
+		t.Run(header, func(t *testing.T) {
+			rec := serveCSV(e, "/cities/import", header+"\nTokyo,JPN,Tokyo-to,100\n")
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
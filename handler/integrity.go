@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// integritySampleSize は問題のある行を例として返す最大件数
+const integritySampleSize = 10
+
+type IntegrityIssue[T any] struct {
+	Count   int `json:"count"`
+	Samples []T `json:"samples"`
+}
+
+type DanglingCapital struct {
+	Code    string        `json:"code"  db:"Code"`
+	Name    string        `json:"name"  db:"Name"`
+	Capital sql.NullInt64 `json:"capital"  db:"Capital"`
+}
+
+type OrphanLanguage struct {
+	CountryCode string `json:"countryCode"  db:"CountryCode"`
+	Language    string `json:"language"  db:"Language"`
+}
+
+type IntegrityReport struct {
+	OrphanCities     IntegrityIssue[City]            `json:"orphanCities"`
+	DanglingCapitals IntegrityIssue[DanglingCapital] `json:"danglingCapitals"`
+	OrphanLanguages  IntegrityIssue[OrphanLanguage]  `json:"orphanLanguages"`
+}
+
+// checkIntegrity は countQuery で問題の件数を、sampleQuery で問題のある行の例を取得する
+func checkIntegrity[T any](ctx context.Context, h *Handler, countQuery string, sampleQuery string) (IntegrityIssue[T], error) {
+	issue := IntegrityIssue[T]{Samples: []T{}}
+	err := h.db.GetContext(ctx, &issue.Count, countQuery)
+	if err != nil {
+		return issue, err
+	}
+	err = h.db.SelectContext(ctx, &issue.Samples, sampleQuery+" LIMIT ?", integritySampleSize)
+	return issue, err
+}
+
+// GetIntegrityHandler はデータの参照整合性の問題を報告する
+//   - 存在しない国コードを持つ都市
+//   - 存在しない都市を首都としている国
+//   - 存在しない国コードを持つ言語
+func (h *Handler) GetIntegrityHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var report IntegrityReport
+	var err error
+
+	report.OrphanCities, err = checkIntegrity[City](ctx, h,
+		"SELECT COUNT(*) FROM city LEFT JOIN country ON city.CountryCode = country.Code WHERE country.Code IS NULL",
+		"SELECT city.* FROM city LEFT JOIN country ON city.CountryCode = country.Code WHERE country.Code IS NULL ORDER BY city.ID")
+	if err != nil {
+		h.logger(c).Error("failed to check orphan cities", "error", err)
+		return internalError(c, err)
+	}
+
+	report.DanglingCapitals, err = checkIntegrity[DanglingCapital](ctx, h,
+		"SELECT COUNT(*) FROM country WHERE Capital IS NOT NULL AND NOT EXISTS (SELECT 1 FROM city WHERE city.ID = country.Capital)",
+		"SELECT Code, Name, Capital FROM country WHERE Capital IS NOT NULL AND NOT EXISTS (SELECT 1 FROM city WHERE city.ID = country.Capital) ORDER BY Code")
+	if err != nil {
+		h.logger(c).Error("failed to check dangling capitals", "error", err)
+		return internalError(c, err)
+	}
+
+	report.OrphanLanguages, err = checkIntegrity[OrphanLanguage](ctx, h,
+		"SELECT COUNT(*) FROM countrylanguage WHERE NOT EXISTS (SELECT 1 FROM country WHERE country.Code = countrylanguage.CountryCode)",
+		"SELECT CountryCode, Language FROM countrylanguage WHERE NOT EXISTS (SELECT 1 FROM country WHERE country.Code = countrylanguage.CountryCode) ORDER BY CountryCode, Language")
+	if err != nil {
+		h.logger(c).Error("failed to check orphan languages", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, report)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetIntegrityHandler(t *testing.T) {
+	h, mock := newMockHandler(t)
+	countRows := func(n int) *sqlmock.Rows { return sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(n) }
+
+	// 存在しない国コード "XXX" を持つ都市が1件ある
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM city LEFT JOIN country ON city\.CountryCode = country\.Code WHERE country\.Code IS NULL`).
+		WillReturnRows(countRows(1))
+	mock.ExpectQuery(`SELECT city\.\* FROM city LEFT JOIN country ON city\.CountryCode = country\.Code WHERE country\.Code IS NULL ORDER BY city\.ID LIMIT \?`).
+		WithArgs(integritySampleSize).
+		WillReturnRows(sqlmock.NewRows(cityColumns).AddRow(4080, "Ghost Town", "XXX", "Nowhere", 10, nil, nil))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM country WHERE Capital IS NOT NULL`).
+		WillReturnRows(countRows(0))
+	mock.ExpectQuery(`SELECT Code, Name, Capital FROM country WHERE Capital IS NOT NULL`).
+		WithArgs(integritySampleSize).
+		WillReturnRows(sqlmock.NewRows([]string{"Code", "Name", "Capital"}))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM countrylanguage`).
+		WillReturnRows(countRows(0))
+	mock.ExpectQuery(`SELECT CountryCode, Language FROM countrylanguage`).
+		WithArgs(integritySampleSize).
+		WillReturnRows(sqlmock.NewRows([]string{"CountryCode", "Language"}))
+
+	e := echo.New()
+	e.GET("/admin/integrity", h.GetIntegrityHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/integrity", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var report IntegrityReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.OrphanCities.Count != 1 || len(report.OrphanCities.Samples) != 1 || report.OrphanCities.Samples[0].CountryCode.String != "XXX" {
+		t.Errorf("orphanCities = %+v, want the city with countryCode XXX", report.OrphanCities)
+	}
+	// 問題がない項目も null ではなく空の配列で返す
+	if report.DanglingCapitals.Count != 0 || report.DanglingCapitals.Samples == nil || len(report.DanglingCapitals.Samples) != 0 {
+		t.Errorf("danglingCapitals = %+v, want none", report.DanglingCapitals)
+	}
+	if report.OrphanLanguages.Count != 0 || report.OrphanLanguages.Samples == nil || len(report.OrphanLanguages.Samples) != 0 {
+		t.Errorf("orphanLanguages = %+v, want none", report.OrphanLanguages)
+	}
+}
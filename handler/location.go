@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultNearbyRadiusKm と maxNearbyRadiusKm は radiusKm の省略時の値と上限
+	defaultNearbyRadiusKm = 100.0
+	maxNearbyRadiusKm     = 1000.0
+	// nearbyLimit は GetNearbyCitiesHandler が返す最大件数
+	nearbyLimit = 50
+)
+
+type NearbyCity struct {
+	City
+	DistanceKm float64 `json:"distanceKm"  db:"DistanceKm"`
+}
+
+// GetNearbyCitiesHandler は都市から radiusKm 以内にある都市を近い順に最大 nearbyLimit 件返す
+// 距離は city_location の緯度・経度からhaversine formulaで求めた大円距離 (km)
+// 都市が存在しないか、位置が登録されていなければ404を返す
+func (h *Handler) GetNearbyCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "id must be an integer")
+	}
+
+	radius := defaultNearbyRadiusKm
+	if s := c.QueryParam("radiusKm"); s != "" {
+		radius, err = strconv.ParseFloat(s, 64)
+		if err != nil || radius <= 0 {
+			return jsonError(c, http.StatusBadRequest, "radiusKm must be a positive number")
+		}
+		if radius > maxNearbyRadiusKm {
+			radius = maxNearbyRadiusKm
+		}
+	}
+
+	var exists bool
+	err = h.db.GetContext(ctx, &exists, "SELECT TRUE FROM city_location WHERE CityID = ?", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusNotFound, "not found")
+		}
+		h.logger(c).Error("failed to get city location", "error", err)
+		return internalError(c, err)
+	}
+
+	cities := []NearbyCity{}
+	err = h.db.SelectContext(ctx, &cities, `SELECT city.*,
+			6371 * 2 * ASIN(SQRT(
+				POW(SIN(RADIANS(l.Latitude - o.Latitude) / 2), 2) +
+				COS(RADIANS(o.Latitude)) * COS(RADIANS(l.Latitude)) * POW(SIN(RADIANS(l.Longitude - o.Longitude) / 2), 2)
+			)) AS DistanceKm
+		FROM city_location o
+		JOIN city_location l ON l.CityID <> o.CityID
+		JOIN city ON city.ID = l.CityID
+		WHERE o.CityID = ?
+		HAVING DistanceKm <= ?
+		ORDER BY DistanceKm ASC, city.ID ASC
+		LIMIT ?`, id, radius, nearbyLimit)
+	if err != nil {
+		h.logger(c).Error("failed to get nearby cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
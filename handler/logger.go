@@ -0,0 +1,46 @@
+package handler
+
+import "github.com/labstack/echo/v4"
+
+// Logger はハンドラーがログを出力するためのインターフェース
+// *slog.Logger がそのまま満たすので、通常は slog を使い、必要なら別の実装に差し替える
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// requestLogger はログにリクエストの情報を付け加える
+type requestLogger struct {
+	logger Logger
+	attrs  []any
+}
+
+func (l requestLogger) with(args []any) []any {
+	return append(append([]any{}, l.attrs...), args...)
+}
+
+func (l requestLogger) Debug(msg string, args ...any) { l.logger.Debug(msg, l.with(args)...) }
+func (l requestLogger) Info(msg string, args ...any)  { l.logger.Info(msg, l.with(args)...) }
+func (l requestLogger) Warn(msg string, args ...any)  { l.logger.Warn(msg, l.with(args)...) }
+func (l requestLogger) Error(msg string, args ...any) { l.logger.Error(msg, l.with(args)...) }
+
+// logger はリクエストのID、メソッド、ルートをログに付け加える Logger を返す
+func (h *Handler) logger(c echo.Context) Logger {
+	return withRequest(h.Logger, c)
+}
+
+// withRequest は logger にリクエストの情報を付け加える
+// Handler を持たないミドルウェアでは slog.Default() を渡して使う
+// リクエストIDは middleware.RequestID が X-Request-ID レスポンスヘッダーに設定したものを使う
+func withRequest(logger Logger, c echo.Context) Logger {
+	return requestLogger{
+		logger: logger,
+		attrs: []any{
+			"request_id", c.Response().Header().Get(echo.HeaderXRequestID),
+			"method", c.Request().Method,
+			"route", c.Path(),
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoggerRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	h := &Handler{Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))}
+
+	e := echo.New()
+	e.GET("/cities/:id", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+		logger := h.logger(c)
+		logger.Debug("debug message")
+		logger.Info("info message")
+		logger.Warn("warn message", "city", 1)
+		logger.Error("error message")
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cities/1", nil))
+
+	out := buf.String()
+	for _, msg := range []string{"debug message", "info message"} {
+		if strings.Contains(out, msg) {
+			t.Errorf("%q was logged below the configured level:\n%s", msg, out)
+		}
+	}
+	for _, msg := range []string{"warn message", "error message"} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("%q was not logged:\n%s", msg, out)
+		}
+	}
+
+	// リクエストの情報と呼び出し側の属性が両方付く
+	for _, attr := range []string{"request_id=req-1", "method=GET", "route=/cities/:id", "city=1"} {
+		if !strings.Contains(out, attr) {
+			t.Errorf("log does not contain %q:\n%s", attr, out)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// parsePagination はクエリパラメータの limit と offset を読み取る
+// 省略時は limit=defaultLimit, offset=0 で、limit は maxLimit で頭打ちにする
+func parsePagination(c echo.Context) (limit int, offset int, err error) {
+	limit = defaultLimit
+	if s := c.QueryParam("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+	}
+	if s := c.QueryParam("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	c.Set(paginationKey, Pagination{Limit: limit, Offset: offset})
+	return limit, offset, nil
+}
+
+// setPaginationHeaders はオフセット方式で返す一覧に X-Total-Count と Link (next/prev) ヘッダーを付ける
+// total は一覧と同じ絞り込み条件で数えた件数を渡す
+// parsePagination を呼んだ後に使う
+func setPaginationHeaders(c echo.Context, total int) {
+	pagination, ok := c.Get(paginationKey).(Pagination)
+	if !ok {
+		return
+	}
+	header := c.Response().Header()
+	header.Set("X-Total-Count", strconv.Itoa(total))
+
+	links := []string{}
+	if next := pagination.Offset + pagination.Limit; next < total {
+		links = append(links, pageLink(c, pagination.Limit, next, "next"))
+	}
+	if pagination.Offset > 0 {
+		prev := max(pagination.Offset-pagination.Limit, 0)
+		links = append(links, pageLink(c, pagination.Limit, prev, "prev"))
+	}
+	if len(links) > 0 {
+		header.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageLink は今のリクエストの limit と offset だけを変えたURLのLinkヘッダーの値を返す
+func pageLink(c echo.Context, limit int, offset int, rel string) string {
+	u := *c.Request().URL
+	query := u.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	u.RawQuery = query.Encode()
+	return "<" + u.RequestURI() + `>; rel="` + rel + `"`
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength はパスワードに必要な最小の文字数
+const minPasswordLength = 8
+
+// validatePassword はパスワードの強度を確認する
+// 8文字以上で、英字と数字をそれぞれ1文字以上含む必要がある
+func validatePassword(pw string) error {
+	if len([]rune(pw)) < minPasswordLength {
+		return errors.New("password must be at least 8 characters")
+	}
+	hasLetter, hasDigit := false, false
+	for _, r := range pw {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter {
+		return errors.New("password must contain at least one letter")
+	}
+	if !hasDigit {
+		return errors.New("password must contain at least one digit")
+	}
+	return nil
+}
+
+type ChangePasswordRequestBody struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+func (h *Handler) ChangePasswordHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var req ChangePasswordRequestBody
+	err := c.Bind(&req)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+
+	// 新しいパスワードが空か、強度が足りなければ400 BadRequestを返す
+	if req.NewPassword == "" {
+		return jsonError(c, http.StatusBadRequest, "newPassword is empty")
+	}
+	err = validatePassword(req.NewPassword)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	// 現在のパスワードが一致しているかを確かめる
+	userName := c.Get("userName").(string)
+	user := User{}
+	err = h.db.GetContext(ctx, &user, "SELECT * FROM users WHERE Username=?", userName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return jsonError(c, http.StatusUnauthorized, "unauthorized")
+		}
+		h.logger(c).Error("failed to get user", "error", err)
+		return internalError(c, err)
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPass), []byte(req.OldPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return jsonError(c, http.StatusUnauthorized, "oldPassword is wrong")
+		}
+		h.logger(c).Error("failed to compare password", "error", err)
+		return internalError(c, err)
+	}
+
+	// 新しいパスワードをハッシュ化して保存する
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), h.BcryptCost)
+	if err != nil {
+		h.logger(c).Error("failed to hash password", "error", err)
+		return internalError(c, err)
+	}
+	_, err = h.db.ExecContext(ctx, "UPDATE users SET HashedPass=? WHERE Username=?", hashedPass, userName)
+	if err != nil {
+		h.logger(c).Error("failed to update password", "error", err)
+		return internalError(c, err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,36 @@
+package handler
+
+import "testing"
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		pw      string
+		wantErr string
+	}{
+		{name: "empty", pw: "", wantErr: "password must be at least 8 characters"},
+		{name: "too short", pw: "abc1234", wantErr: "password must be at least 8 characters"},
+		{name: "minimum length", pw: "abcdefg1"},
+		{name: "multibyte counted as characters", pw: "パスワード123"},
+		{name: "multibyte too short", pw: "パス1234", wantErr: "password must be at least 8 characters"},
+		{name: "digits only", pw: "12345678", wantErr: "password must contain at least one letter"},
+		{name: "letters only", pw: "abcdefgh", wantErr: "password must contain at least one digit"},
+		{name: "symbols only", pw: "!@#$%^&*", wantErr: "password must contain at least one letter"},
+		{name: "letters digits and symbols", pw: "p@ssw0rd!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePassword(tt.pw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validatePassword(%q) = %v, want nil", tt.pw, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("validatePassword(%q) = %v, want %q", tt.pw, err, tt.wantErr)
+			}
+		})
+	}
+}
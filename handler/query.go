@@ -0,0 +1,23 @@
+package handler
+
+import "strings"
+
+// queryBuilder はWHERE句の条件と引数を組み立てる
+// 値は必ずプレースホルダーで渡し、SQLに直接埋め込まない
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (b *queryBuilder) where(condition string, args ...interface{}) {
+	b.conditions = append(b.conditions, condition)
+	b.args = append(b.args, args...)
+}
+
+// whereClause は条件をANDでつないだWHERE句を返す。条件がなければ空文字列を返す
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
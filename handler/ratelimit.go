@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultLoginMaxFailures はログインを一時的に拒否するまでに許す失敗回数
+	defaultLoginMaxFailures = 5
+	// defaultLoginFailureWindow は失敗回数を数える期間
+	defaultLoginFailureWindow = 15 * time.Minute
+	// loginSweepInterval はこの間隔ごとに、期限切れの記録をまとめて削除する
+	loginSweepInterval = time.Minute
+	// maxLoginRecords は記録するユーザー名とIPアドレスの最大数
+	// ランダムなユーザー名で失敗し続けられてもメモリを使い切らないようにする
+	maxLoginRecords = 100000
+)
+
+type attemptRecord struct {
+	failures []time.Time
+}
+
+// loginLimiter はユーザー名やIPアドレスごとにログインの失敗を記録する
+type loginLimiter struct {
+	mu        sync.Mutex
+	attempts  map[string]*attemptRecord
+	lastSweep time.Time
+	// maxRecords は記録の最大数。テストで小さくできるようにフィールドにしている
+	maxRecords int
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{attempts: map[string]*attemptRecord{}, maxRecords: maxLoginRecords}
+}
+
+// prune は window より古い失敗を捨てる。失敗が残っていなければ記録ごと削除する
+func (l *loginLimiter) prune(key string, window time.Duration, now time.Time) *attemptRecord {
+	record, ok := l.attempts[key]
+	if !ok {
+		return nil
+	}
+	failures := record.failures[:0]
+	for _, t := range record.failures {
+		if now.Sub(t) < window {
+			failures = append(failures, t)
+		}
+	}
+	record.failures = failures
+	if len(failures) == 0 {
+		delete(l.attempts, key)
+		return nil
+	}
+	return record
+}
+
+// blocked は keys のいずれかが window の間に maxFailures 回以上失敗しているかを返す
+func (l *loginLimiter) blocked(maxFailures int, window time.Duration, keys ...string) bool {
+	remaining, _ := l.status(maxFailures, window, keys...)
+	return remaining == 0
+}
+
+// status は keys のうち最も失敗の多いものについて、拒否されるまでに残っている失敗の回数と、
+// 最も古い失敗が期限切れになって残りの回数が増える時刻を返す
+// 失敗が記録されていなければ maxFailures とゼロ値の時刻を返す
+func (l *loginLimiter) status(maxFailures int, window time.Duration, keys ...string) (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	remaining := maxFailures
+	var reset time.Time
+	for _, key := range keys {
+		record := l.prune(key, window, now)
+		if record == nil {
+			continue
+		}
+		if left := max(maxFailures-len(record.failures), 0); left < remaining {
+			remaining = left
+			reset = record.failures[0].Add(window)
+		}
+	}
+	return remaining, reset
+}
+
+// recordFailure は keys の失敗を記録する
+// 一定間隔で期限切れの記録を全て削除し、それでも maxRecords に達していれば任意の記録を捨てて空きを作る
+func (l *loginLimiter) recordFailure(window time.Duration, keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= loginSweepInterval {
+		l.sweep(window, now)
+	}
+	for _, key := range keys {
+		record, ok := l.attempts[key]
+		if !ok {
+			if len(l.attempts) >= l.maxRecords {
+				l.evictOne()
+			}
+			record = &attemptRecord{}
+			l.attempts[key] = record
+		}
+		record.failures = append(record.failures, now)
+	}
+}
+
+// sweep は全ての記録から window より古い失敗を捨てる
+func (l *loginLimiter) sweep(window time.Duration, now time.Time) {
+	for key := range l.attempts {
+		l.prune(key, window, now)
+	}
+	l.lastSweep = now
+}
+
+// evictOne は記録を1つ捨てる。mapの走査順は決まっていないので、どれが捨てられるかは不定
+func (l *loginLimiter) evictOne() {
+	for key := range l.attempts {
+		delete(l.attempts, key)
+		return
+	}
+}
+
+func (l *loginLimiter) reset(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		delete(l.attempts, key)
+	}
+}
+
+// loginLimits は Handler に設定されたログイン制限の値を返す。未設定ならデフォルト値を使う
+func (h *Handler) loginLimits() (int, time.Duration) {
+	maxFailures := h.LoginMaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultLoginMaxFailures
+	}
+	window := h.LoginFailureWindow
+	if window <= 0 {
+		window = defaultLoginFailureWindow
+	}
+	return maxFailures, window
+}
+
+// setLoginRateLimitHeaders はログインの制限の状態を X-RateLimit-* ヘッダーで返す
+// クライアントが429になる前に自分から間隔を空けられるようにする
+// X-RateLimit-Reset は残りの回数が増えるまでの秒数 (失敗がなければ0)
+func (h *Handler) setLoginRateLimitHeaders(c echo.Context, keys ...string) {
+	maxFailures, window := h.loginLimits()
+	remaining, reset := h.loginAttempts.status(maxFailures, window, keys...)
+	resetSeconds := 0
+	if !reset.IsZero() {
+		resetSeconds = max(int(math.Ceil(time.Until(reset).Seconds())), 0)
+	}
+	header := c.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(maxFailures))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+}
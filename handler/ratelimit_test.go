@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLoginLimiterBlocksAfterMaxFailures(t *testing.T) {
+	l := newLoginLimiter()
+	window := time.Minute
+	for i := 0; i < 3; i++ {
+		if l.blocked(3, window, "user:alice", "ip:192.0.2.1") {
+			t.Fatalf("blocked after %d failures", i)
+		}
+		l.recordFailure(window, "user:alice", "ip:192.0.2.1")
+	}
+	if !l.blocked(3, window, "user:alice") {
+		t.Error("user is not blocked after 3 failures")
+	}
+	if !l.blocked(3, window, "user:bob", "ip:192.0.2.1") {
+		t.Error("ip is not blocked after 3 failures")
+	}
+
+	l.reset("user:alice")
+	if l.blocked(3, window, "user:alice") {
+		t.Error("user is still blocked after reset")
+	}
+}
+
+func TestLoginLimiterSweepsExpiredRecords(t *testing.T) {
+	l := newLoginLimiter()
+	window := time.Minute
+	old := time.Now().Add(-2 * window)
+	for i := 0; i < 10; i++ {
+		l.attempts["user:"+strconv.Itoa(i)] = &attemptRecord{failures: []time.Time{old}}
+	}
+	l.lastSweep = time.Now().Add(-2 * loginSweepInterval)
+
+	l.recordFailure(window, "user:new")
+
+	if len(l.attempts) != 1 {
+		t.Fatalf("records = %d, want 1 (expired records should be swept)", len(l.attempts))
+	}
+	if _, ok := l.attempts["user:new"]; !ok {
+		t.Error("new record is missing")
+	}
+}
+
+func TestLoginLimiterCapsRecords(t *testing.T) {
+	l := newLoginLimiter()
+	l.maxRecords = 5
+	window := time.Minute
+	for i := 0; i < 20; i++ {
+		l.recordFailure(window, "user:"+strconv.Itoa(i))
+	}
+	if len(l.attempts) > l.maxRecords {
+		t.Fatalf("records = %d, want at most %d", len(l.attempts), l.maxRecords)
+	}
+	if _, ok := l.attempts["user:19"]; !ok {
+		t.Error("latest record was evicted")
+	}
+}
+
+func TestLoginLimiterStatus(t *testing.T) {
+	l := newLoginLimiter()
+	window := time.Minute
+
+	remaining, reset := l.status(3, window, "user:alice", "ip:192.0.2.1")
+	if remaining != 3 || !reset.IsZero() {
+		t.Fatalf("status() = %d, %v, want 3 and zero time", remaining, reset)
+	}
+
+	first := time.Now()
+	l.recordFailure(window, "user:alice", "ip:192.0.2.1")
+	l.recordFailure(window, "ip:192.0.2.1")
+
+	// 失敗の多い方 (IPアドレス) の残りの回数を返す
+	remaining, reset = l.status(3, window, "user:alice", "ip:192.0.2.1")
+	if remaining != 1 {
+		t.Errorf("remaining = %d, want 1", remaining)
+	}
+	if reset.Before(first.Add(window)) || reset.After(time.Now().Add(window)) {
+		t.Errorf("reset = %v, want oldest failure + %v", reset, window)
+	}
+
+	l.recordFailure(window, "ip:192.0.2.1")
+	l.recordFailure(window, "ip:192.0.2.1")
+	if remaining, _ := l.status(3, window, "ip:192.0.2.1"); remaining != 0 {
+		t.Errorf("remaining = %d, want 0 after exceeding the limit", remaining)
+	}
+}
+
+func TestLoginHandlerRateLimitHeaders(t *testing.T) {
+	h, mock := newMockHandler(t)
+	h.LoginMaxFailures = 3
+	e := newSessionEcho()
+	e.POST("/login", h.LoginHandler)
+
+	// 失敗するたびに残りの回数が減り、0になると429を返す
+	for i, wantRemaining := range []string{"2", "1", "0"} {
+		mock.ExpectQuery(`SELECT \* FROM users WHERE Username=\?`).
+			WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows(userColumns))
+
+		rec := serveJSON(e, http.MethodPost, "/login", `{"username": "alice", "password": "password123"}`)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+		assertRateLimitHeaders(t, rec, "3", wantRemaining)
+	}
+
+	rec := serveJSON(e, http.MethodPost, "/login", `{"username": "alice", "password": "password123"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	assertRateLimitHeaders(t, rec, "3", "0")
+}
+
+func assertRateLimitHeaders(t *testing.T, rec *httptest.ResponseRecorder, wantLimit, wantRemaining string) {
+	t.Helper()
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != wantLimit {
+		t.Errorf("X-RateLimit-Limit = %q, want %q", got, wantLimit)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != wantRemaining {
+		t.Errorf("X-RateLimit-Remaining = %q, want %q", got, wantRemaining)
+	}
+	reset, err := strconv.Atoi(rec.Header().Get("X-RateLimit-Reset"))
+	if err != nil || reset <= 0 || reset > int(defaultLoginFailureWindow/time.Second) {
+		t.Errorf("X-RateLimit-Reset = %q, want seconds within the window", rec.Header().Get("X-RateLimit-Reset"))
+	}
+}
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RecoverMiddleware はハンドラーのpanicを回復し、スタックトレースをログに残して500を返す
+// レスポンスは ErrorHandler が他のエラーと同じJSONの形式で返す
+func RecoverMiddleware() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			withRequest(slog.Default(), c).Error("recovered from panic", "error", err, "stack", string(stack))
+			return echo.NewHTTPError(http.StatusInternalServerError, "internal server error").SetInternal(err)
+		},
+	})
+}
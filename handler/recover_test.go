@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler
+	e.Use(RecoverMiddleware())
+	e.GET("/panic", func(c echo.Context) error {
+		_ = c.Get("userName").(string)
+		return nil
+	})
+	e.GET("/ok", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != echo.MIMEApplicationJSON {
+		t.Errorf("Content-Type = %q, want %q", got, echo.MIMEApplicationJSON)
+	}
+	var res ErrorResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatalf("body is not JSON: %q", rec.Body.String())
+	}
+	want := ErrorResponse{Error: "internal server error", Status: http.StatusInternalServerError}
+	if res != want {
+		t.Errorf("body = %+v, want %+v", res, want)
+	}
+
+	// panicの後も次のリクエストを処理できる
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("after panic: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// envelopeKey は EnvelopeMiddleware がデフォルトでエンベロープを使うかを保存するcontextのキー
+const envelopeKey = "envelope"
+
+// paginationKey は parsePagination が読み取ったページングの情報を保存するcontextのキー
+const paginationKey = "pagination"
+
+type Envelope struct {
+	Data interface{}  `json:"data"`
+	Meta EnvelopeMeta `json:"meta"`
+}
+
+type EnvelopeMeta struct {
+	RequestID  string      `json:"requestId,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+type Pagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// EnvelopeMiddleware はレスポンスをエンベロープで包むかどうかのデフォルトを設定する
+// リクエストごとに X-Response-Envelope ヘッダー (true/false) で上書きできる
+func EnvelopeMiddleware(enabled bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(envelopeKey, enabled)
+			return next(c)
+		}
+	}
+}
+
+// wantsEnvelope はレスポンスを {"data": ..., "meta": ...} で包むかを返す
+func wantsEnvelope(c echo.Context) bool {
+	switch c.Request().Header.Get("X-Response-Envelope") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	enabled, _ := c.Get(envelopeKey).(bool)
+	return enabled
+}
+
+// respondJSON はハンドラーの成功レスポンスを返すための共通の関数
+// クライアントが完全な表現を要求した場合は omitempty を無視して全てのフィールドを返す
+// エンベロープが有効な場合は data と meta (リクエストIDやページング) で包んで返す
+func respondJSON(c echo.Context, status int, v interface{}) error {
+	if wantsFullRepresentation(c) {
+		v = fullRepresentation(v)
+	}
+	if wantsEnvelope(c) {
+		meta := EnvelopeMeta{RequestID: c.Response().Header().Get(echo.HeaderXRequestID)}
+		if pagination, ok := c.Get(paginationKey).(Pagination); ok {
+			meta.Pagination = &pagination
+		}
+		v = Envelope{Data: v, Meta: meta}
+	}
+	return c.JSON(status, v)
+}
+
+// wantsFullRepresentation はクエリパラメータ full=true か
+// ヘッダー X-Full-Representation: true で完全な表現が要求されているかを返す
+// omitempty により 0 のフィールドが省略されると「0」と「値なし」を区別できないため
+func wantsFullRepresentation(c echo.Context) bool {
+	return c.QueryParam("full") == "true" || c.Request().Header.Get("X-Full-Representation") == "true"
+}
+
+// fullRepresentation は構造体を omitempty を無視したmapに変換する
+// ネストした構造体・ポインタ・スライス・mapの中身も同じように変換する
+// time.Time のように独自のJSON表現を持つ値はそのまま返す
+func fullRepresentation(v interface{}) interface{} {
+	switch v.(type) {
+	case nil, json.Marshaler, encoding.TextMarshaler:
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return v
+		}
+		return fullRepresentation(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		// []byte は encoding/json と同じくbase64の文字列にするので変換しない
+		if rv.Kind() == reflect.Slice && (rv.IsNil() || rv.Type().Elem().Kind() == reflect.Uint8) {
+			return v
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = fullRepresentation(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		elemType := reflect.TypeOf((*interface{})(nil)).Elem()
+		out := reflect.MakeMapWithSize(reflect.MapOf(rv.Type().Key(), elemType), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			// reflect.ValueOf(nil) を渡すとキーが削除されるので、interface{} の値として設定する
+			elem := reflect.New(elemType).Elem()
+			if full := fullRepresentation(iter.Value().Interface()); full != nil {
+				elem.Set(reflect.ValueOf(full))
+			}
+			out.SetMapIndex(iter.Key(), elem)
+		}
+		return out.Interface()
+	case reflect.Struct:
+		out := map[string]interface{}{}
+		addStructFields(out, rv)
+		return out
+	default:
+		return v
+	}
+}
+
+// addStructFields は構造体のフィールドを json タグの名前で out に追加する
+// タグのない埋め込み構造体は encoding/json と同じようにフィールドを展開する
+func addStructFields(out map[string]interface{}, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(out, rv.Field(i))
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		out[name] = fullRepresentation(rv.Field(i).Interface())
+	}
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// decodeJSON はレスポンスのボディを汎用の値にデコードする
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder) interface{} {
+	t.Helper()
+	var v interface{}
+	err := json.Unmarshal(rec.Body.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("body is not JSON: %q", rec.Body.String())
+	}
+	return v
+}
+
+func TestRespondJSONFullRepresentation(t *testing.T) {
+	diff := CityDiff{
+		Added:   []CityInput{},
+		Removed: []CityInput{},
+		Changed: []CityChange{{
+			From: CityInput{ID: 1, Name: "Tokyo", CountryCode: "JPN", Population: 0},
+			To:   CityInput{ID: 1, Name: "Tokyo", CountryCode: "JPN", Population: 100},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		header   string
+		wantFrom map[string]interface{}
+	}{
+		{
+			name:     "default omits zero values",
+			target:   "/",
+			wantFrom: map[string]interface{}{"id": 1.0, "name": "Tokyo", "countryCode": "JPN"},
+		},
+		{
+			name:     "full query keeps nested zero values",
+			target:   "/?full=true",
+			wantFrom: map[string]interface{}{"id": 1.0, "name": "Tokyo", "countryCode": "JPN", "district": "", "population": 0.0},
+		},
+		{
+			name:     "full header keeps nested zero values",
+			target:   "/",
+			header:   "true",
+			wantFrom: map[string]interface{}{"id": 1.0, "name": "Tokyo", "countryCode": "JPN", "district": "", "population": 0.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Full-Representation", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			err := respondJSON(echo.New().NewContext(req, rec), http.StatusOK, diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := decodeJSON(t, rec).(map[string]interface{})
+			from := body["changed"].([]interface{})[0].(map[string]interface{})["from"]
+			if !reflect.DeepEqual(from, tt.wantFrom) {
+				t.Errorf("changed[0].from = %v, want %v", from, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestFullRepresentation(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	type item struct {
+		Count int `json:"count,omitempty"`
+	}
+	type page struct {
+		Items   []item          `json:"items,omitempty"`
+		ByName  map[string]item `json:"byName,omitempty"`
+		Next    *item           `json:"next,omitempty"`
+		Created time.Time       `json:"created"`
+		Raw     []byte          `json:"raw,omitempty"`
+	}
+
+	got, err := json.Marshal(fullRepresentation(page{
+		Items:   []item{{Count: 0}},
+		ByName:  map[string]item{"a": {Count: 0}},
+		Next:    &item{Count: 0},
+		Created: createdAt,
+		Raw:     []byte("ab"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"byName":{"a":{"count":0}},"created":"2024-01-02T03:04:05Z","items":[{"count":0}],"next":{"count":0},"raw":"YWI="}`
+	if string(got) != want {
+		t.Fatalf("fullRepresentation() = %s, want %s", got, want)
+	}
+}
+
+func TestEnvelopeMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		header   string
+		wantWrap bool
+	}{
+		{name: "disabled by default", enabled: false, wantWrap: false},
+		{name: "enabled by default", enabled: true, wantWrap: true},
+		{name: "header enables", enabled: false, header: "true", wantWrap: true},
+		{name: "header disables", enabled: true, header: "false", wantWrap: false},
+		{name: "unknown header keeps default", enabled: true, header: "yes", wantWrap: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(middleware.RequestID())
+			e.Use(EnvelopeMiddleware(tt.enabled))
+			e.GET("/", func(c echo.Context) error {
+				c.Set(paginationKey, Pagination{Limit: 10, Offset: 20})
+				return respondJSON(c, http.StatusOK, map[string]string{"name": "Tokyo"})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Response-Envelope", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			body := decodeJSON(t, rec).(map[string]interface{})
+			if !tt.wantWrap {
+				want := map[string]interface{}{"name": "Tokyo"}
+				if !reflect.DeepEqual(body, want) {
+					t.Errorf("body = %v, want %v", body, want)
+				}
+				return
+			}
+
+			wantData := map[string]interface{}{"name": "Tokyo"}
+			if !reflect.DeepEqual(body["data"], wantData) {
+				t.Errorf("data = %v, want %v", body["data"], wantData)
+			}
+			meta := body["meta"].(map[string]interface{})
+			if meta["requestId"] != rec.Header().Get(echo.HeaderXRequestID) || meta["requestId"] == "" {
+				t.Errorf("meta.requestId = %v, want %q", meta["requestId"], rec.Header().Get(echo.HeaderXRequestID))
+			}
+			wantPagination := map[string]interface{}{"limit": 10.0, "offset": 20.0}
+			if !reflect.DeepEqual(meta["pagination"], wantPagination) {
+				t.Errorf("meta.pagination = %v, want %v", meta["pagination"], wantPagination)
+			}
+		})
+	}
+}
+
+func TestEnvelopeMiddlewareLeavesErrorsUnwrapped(t *testing.T) {
+	e := echo.New()
+	e.Use(EnvelopeMiddleware(true))
+	e.GET("/", func(c echo.Context) error {
+		return jsonError(c, http.StatusNotFound, "city not found")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	body := decodeJSON(t, rec).(map[string]interface{})
+	if _, ok := body["data"]; ok {
+		t.Errorf("error response was wrapped: %v", body)
+	}
+	if body["error"] != "city not found" || body["status"] != float64(http.StatusNotFound) {
+		t.Errorf("body = %v", body)
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminOnlyMiddleware は管理者でないユーザーからのリクエストを403で拒否する
+// UserAuthMiddleware の後に使う。管理者かどうかは毎回DBから読み込むので、権限の変更はすぐに反映される
+func (h *Handler) AdminOnlyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx, cancel := dbContext(c)
+		defer cancel()
+
+		var isAdmin bool
+		err := h.db.GetContext(ctx, &isAdmin, "SELECT IsAdmin FROM users WHERE Username=?", c.Get("userName").(string))
+		if err != nil {
+			// セッションが残っていてもユーザーが削除されていれば管理者ではない
+			if !errors.Is(err, sql.ErrNoRows) {
+				h.logger(c).Error("failed to get user role", "error", err)
+				return internalError(c, err)
+			}
+		}
+		if !isAdmin {
+			return jsonError(c, http.StatusForbidden, "forbidden")
+		}
+		return next(c)
+	}
+}
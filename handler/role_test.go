@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAdminOnlyMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       *sqlmock.Rows
+		err        error
+		wantStatus int
+	}{
+		{name: "admin", rows: sqlmock.NewRows([]string{"IsAdmin"}).AddRow(true), wantStatus: http.StatusOK},
+		{name: "regular user", rows: sqlmock.NewRows([]string{"IsAdmin"}).AddRow(false), wantStatus: http.StatusForbidden},
+		// セッションが残っていても削除されたユーザーは管理者ではない
+		{name: "deleted user", rows: sqlmock.NewRows([]string{"IsAdmin"}), wantStatus: http.StatusForbidden},
+		{name: "database error", err: errors.New("connection reset"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newMockHandler(t)
+			query := mock.ExpectQuery(`SELECT IsAdmin FROM users WHERE Username=\?`).WithArgs("alice")
+			if tt.err != nil {
+				query.WillReturnError(tt.err)
+			} else {
+				query.WillReturnRows(tt.rows)
+			}
+
+			called := false
+			e := echo.New()
+			e.GET("/admin/integrity", func(c echo.Context) error {
+				called = true
+				return c.NoContent(http.StatusOK)
+			}, withUser("alice"), h.AdminOnlyMiddleware)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/integrity", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("handler called = %v, want %v", called, tt.wantStatus == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+)
+
+// suspiciousInputPattern はSQLインジェクションでよく使われる記号や構文にマッチする
+// "N'Djamena" のようにアポストロフィを含む都市名は正当なので、アポストロフィ単体ではマッチさせない
+var suspiciousInputPattern = regexp.MustCompile(`(?i)(--|;|/\*|\*/|\bunion\s+(all\s+)?select\b|\b(drop|alter|truncate)\s+table\b|\binsert\s+into\b|\bdelete\s+from\b|\bsleep\s*\(|'\s*(or|and)\s)`)
+
+// isSuspiciousInput は入力がSQLのような文字列を含むかを返す
+func isSuspiciousInput(s string) bool {
+	return suspiciousInputPattern.MatchString(s)
+}
+
+// SuspiciousInputMiddleware はパスパラメータとクエリパラメータにSQLのような文字列が含まれていたら
+// ログに記録して400 Bad Requestを返す
+// クエリは全てパラメータ化されているので、多層防御のためのもの
+func SuspiciousInputMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		values := append([]string{}, c.ParamValues()...)
+		for _, v := range c.QueryParams() {
+			values = append(values, v...)
+		}
+		for _, v := range values {
+			if isSuspiciousInput(v) {
+				withRequest(slog.Default(), c).Warn("rejected suspicious input", "ip", c.RealIP(), "value", v)
+				return jsonError(c, http.StatusBadRequest, "suspicious input")
+			}
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestIsSuspiciousInput(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		// 正当な値
+		{input: "", want: false},
+		{input: "Tokyo", want: false},
+		{input: "N'Djamena", want: false},
+		{input: "L'Aquila", want: false},
+		{input: "Côte d'Ivoire", want: false},
+		{input: "Saint-Étienne", want: false},
+		{input: "Stratford-upon-Avon", want: false},
+		{input: "O'Brien and Sons", want: false},
+		{input: "Union City", want: false},
+		{input: "Selection", want: false},
+		{input: "Sleepy Hollow", want: false},
+		{input: "a-b", want: false},
+
+		// 拒否する値
+		{input: "1; DROP TABLE users", want: true},
+		{input: "Tokyo--", want: true},
+		{input: "/* comment */", want: true},
+		{input: "1 UNION SELECT password FROM users", want: true},
+		{input: "1 union all select 1", want: true},
+		{input: "x' OR '1'='1", want: true},
+		{input: "x' and 1=1", want: true},
+		{input: "drop table city", want: true},
+		{input: "ALTER TABLE city", want: true},
+		{input: "truncate table city", want: true},
+		{input: "insert into users values (1)", want: true},
+		{input: "delete from city", want: true},
+		{input: "sleep(5)", want: true},
+		{input: "SLEEP (5)", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := isSuspiciousInput(tt.input); got != tt.want {
+				t.Fatalf("isSuspiciousInput(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuspiciousInputMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(SuspiciousInputMiddleware)
+	e.GET("/cities/:cityName", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "apostrophe in path", target: "/cities/" + url.PathEscape("N'Djamena"), want: http.StatusOK},
+		{name: "hyphen in query", target: "/cities/Tokyo?district=" + url.QueryEscape("Saint-Denis"), want: http.StatusOK},
+		{name: "sql in path", target: "/cities/" + url.PathEscape("x' OR 1=1 --"), want: http.StatusBadRequest},
+		{name: "sql in query", target: "/cities/Tokyo?district=" + url.QueryEscape("1 UNION SELECT 1"), want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
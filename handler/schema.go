@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// expectedColumns はテーブルごとに、Goの構造体が前提としているカラムを返す
+func expectedColumns() map[string][]string {
+	return map[string][]string{
+		"city":    dbColumns(City{}),
+		"users":   dbColumns(User{}),
+		"country": dbColumns(Country{}),
+	}
+}
+
+// dbColumns は構造体の db タグからカラム名の一覧を作る
+func dbColumns(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	columns := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if column := t.Field(i).Tag.Get("db"); column != "" && column != "-" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// CheckSchema は実際のテーブルのカラムと構造体が前提としているカラムを比較し、
+// 足りないカラムを1件ずつメッセージにして返す
+func (h *Handler) CheckSchema() ([]string, error) {
+	actual := map[string][]string{}
+	for table := range expectedColumns() {
+		var columns []string
+		err := h.db.Select(&columns, "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table)
+		if err != nil {
+			return nil, err
+		}
+		actual[table] = columns
+	}
+	return missingColumns(expectedColumns(), actual), nil
+}
+
+// missingColumns は期待するカラムのうち、実際のテーブルにないものをメッセージにして返す
+// actual にカラムが1つもないテーブルは、テーブル自体がないものとして報告する
+func missingColumns(expected, actual map[string][]string) []string {
+	problems := []string{}
+	for table, columns := range expected {
+		if len(actual[table]) == 0 {
+			problems = append(problems, fmt.Sprintf("table %s does not exist", table))
+			continue
+		}
+
+		// MySQLのカラム名は大文字小文字を区別しない
+		exists := map[string]bool{}
+		for _, column := range actual[table] {
+			exists[strings.ToLower(column)] = true
+		}
+		for _, column := range columns {
+			if !exists[strings.ToLower(column)] {
+				problems = append(problems, fmt.Sprintf("column %s.%s does not exist", table, column))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
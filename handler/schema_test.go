@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingColumns(t *testing.T) {
+	expected := map[string][]string{
+		"city":  {"ID", "Name", "Population"},
+		"users": {"Username", "HashedPass"},
+	}
+
+	tests := []struct {
+		name   string
+		actual map[string][]string
+		want   []string
+	}{
+		{
+			name: "all columns exist",
+			actual: map[string][]string{
+				"city":  {"ID", "Name", "Population", "Extra"},
+				"users": {"Username", "HashedPass"},
+			},
+			want: []string{},
+		},
+		{
+			name: "column names are case insensitive",
+			actual: map[string][]string{
+				"city":  {"id", "NAME", "population"},
+				"users": {"username", "hashedpass"},
+			},
+			want: []string{},
+		},
+		{
+			name: "missing columns are reported in order",
+			actual: map[string][]string{
+				"city":  {"ID"},
+				"users": {"Username"},
+			},
+			want: []string{
+				"column city.Name does not exist",
+				"column city.Population does not exist",
+				"column users.HashedPass does not exist",
+			},
+		},
+		{
+			name: "missing table",
+			actual: map[string][]string{
+				"city": {"ID", "Name", "Population"},
+			},
+			want: []string{"table users does not exist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingColumns(expected, tt.actual)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingColumns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBColumnsMatchesCityStruct(t *testing.T) {
+	want := []string{"ID", "Name", "CountryCode", "District", "Population", "CreatedAt", "CreatedBy"}
+	if got := dbColumns(City{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("dbColumns(City{}) = %q, want %q", got, want)
+	}
+}
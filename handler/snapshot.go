@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SnapshotRequestBody struct {
+	Name string `json:"name"`
+}
+
+type CityChange struct {
+	From CityInput `json:"from"`
+	To   CityInput `json:"to"`
+}
+
+type CityDiff struct {
+	Added   []CityInput  `json:"added"`
+	Removed []CityInput  `json:"removed"`
+	Changed []CityChange `json:"changed"`
+}
+
+// PostCitySnapshotHandler は現在のcityテーブルを name という名前のスナップショットとして保存する
+func (h *Handler) PostCitySnapshotHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var req SnapshotRequestBody
+	err := c.Bind(&req)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+	if req.Name == "" {
+		return jsonError(c, http.StatusBadRequest, "name is empty")
+	}
+
+	exists, err := h.snapshotExists(ctx, req.Name)
+	if err != nil {
+		h.logger(c).Error("failed to check snapshot", "error", err)
+		return internalError(c, err)
+	}
+	if exists {
+		return jsonError(c, http.StatusConflict, "snapshot already exists")
+	}
+
+	_, err = h.db.ExecContext(ctx, "INSERT INTO city_snapshot (SnapshotName, ID, Name, CountryCode, District, Population) SELECT ?, ID, Name, CountryCode, District, Population FROM city", req.Name)
+	if err != nil {
+		h.logger(c).Error("failed to create snapshot", "error", err)
+		return internalError(c, err)
+	}
+
+	return c.NoContent(http.StatusCreated)
+}
+
+func (h *Handler) snapshotExists(ctx context.Context, name string) (bool, error) {
+	var count int
+	err := h.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM city_snapshot WHERE SnapshotName = ?", name)
+	return count > 0, err
+}
+
+func (h *Handler) loadSnapshot(ctx context.Context, name string) (map[int]CityInput, error) {
+	var cities []CityInput
+	err := h.db.SelectContext(ctx, &cities, "SELECT ID, Name, CountryCode, District, Population FROM city_snapshot WHERE SnapshotName = ?", name)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[int]CityInput, len(cities))
+	for _, city := range cities {
+		snapshot[city.ID] = city
+	}
+	return snapshot, nil
+}
+
+// diffSnapshots はIDをキーにして2つのスナップショットの差分を求める
+// 結果はIDの昇順に並ぶ
+func diffSnapshots(from map[int]CityInput, to map[int]CityInput) CityDiff {
+	diff := CityDiff{Added: []CityInput{}, Removed: []CityInput{}, Changed: []CityChange{}}
+	for id, before := range from {
+		after, ok := to[id]
+		if !ok {
+			diff.Removed = append(diff.Removed, before)
+		} else if before != after {
+			diff.Changed = append(diff.Changed, CityChange{From: before, To: after})
+		}
+	}
+	for id, after := range to {
+		if _, ok := from[id]; !ok {
+			diff.Added = append(diff.Added, after)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].ID < diff.Added[j].ID })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].ID < diff.Removed[j].ID })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].From.ID < diff.Changed[j].From.ID })
+	return diff
+}
+
+func (h *Handler) GetCitySnapshotDiffHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	fromName := c.QueryParam("from")
+	toName := c.QueryParam("to")
+	if fromName == "" || toName == "" {
+		return jsonError(c, http.StatusBadRequest, "from and to are required")
+	}
+
+	snapshots := []map[int]CityInput{}
+	for _, name := range []string{fromName, toName} {
+		exists, err := h.snapshotExists(ctx, name)
+		if err != nil {
+			h.logger(c).Error("failed to check snapshot", "error", err)
+			return internalError(c, err)
+		}
+		if !exists {
+			return jsonError(c, http.StatusNotFound, "snapshot "+name+" does not exist")
+		}
+		snapshot, err := h.loadSnapshot(ctx, name)
+		if err != nil {
+			h.logger(c).Error("failed to load snapshot", "error", err)
+			return internalError(c, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return respondJSON(c, http.StatusOK, diffSnapshots(snapshots[0], snapshots[1]))
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	tokyo := CityInput{ID: 1, Name: "Tokyo", CountryCode: "JPN", District: "Tokyo-to", Population: 7980230}
+	osaka := CityInput{ID: 2, Name: "Osaka", CountryCode: "JPN", District: "Osaka", Population: 2595674}
+	kyoto := CityInput{ID: 3, Name: "Kyoto", CountryCode: "JPN", District: "Kyoto", Population: 1468980}
+	nara := CityInput{ID: 4, Name: "Nara", CountryCode: "JPN", District: "Nara", Population: 362812}
+
+	tokyoZero := tokyo
+	tokyoZero.Population = 0
+	osakaRenamed := osaka
+	osakaRenamed.Name = "Ōsaka"
+
+	tests := []struct {
+		name string
+		from map[int]CityInput
+		to   map[int]CityInput
+		want CityDiff
+	}{
+		{
+			name: "identical",
+			from: map[int]CityInput{1: tokyo, 2: osaka},
+			to:   map[int]CityInput{1: tokyo, 2: osaka},
+			want: CityDiff{Added: []CityInput{}, Removed: []CityInput{}, Changed: []CityChange{}},
+		},
+		{
+			name: "added",
+			from: map[int]CityInput{1: tokyo},
+			to:   map[int]CityInput{1: tokyo, 4: nara, 3: kyoto},
+			want: CityDiff{Added: []CityInput{kyoto, nara}, Removed: []CityInput{}, Changed: []CityChange{}},
+		},
+		{
+			name: "removed",
+			from: map[int]CityInput{1: tokyo, 2: osaka, 3: kyoto},
+			to:   map[int]CityInput{2: osaka},
+			want: CityDiff{Added: []CityInput{}, Removed: []CityInput{tokyo, kyoto}, Changed: []CityChange{}},
+		},
+		{
+			name: "changed to zero population",
+			from: map[int]CityInput{1: tokyo},
+			to:   map[int]CityInput{1: tokyoZero},
+			want: CityDiff{Added: []CityInput{}, Removed: []CityInput{}, Changed: []CityChange{{From: tokyo, To: tokyoZero}}},
+		},
+		{
+			name: "added, removed and changed",
+			from: map[int]CityInput{1: tokyo, 2: osaka, 3: kyoto},
+			to:   map[int]CityInput{1: tokyoZero, 2: osakaRenamed, 4: nara},
+			want: CityDiff{
+				Added:   []CityInput{nara},
+				Removed: []CityInput{kyoto},
+				Changed: []CityChange{{From: tokyo, To: tokyoZero}, {From: osaka, To: osakaRenamed}},
+			},
+		},
+		{
+			name: "empty snapshots",
+			from: map[int]CityInput{},
+			to:   map[int]CityInput{},
+			want: CityDiff{Added: []CityInput{}, Removed: []CityInput{}, Changed: []CityChange{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffSnapshots(tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffSnapshots() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
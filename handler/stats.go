@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+type CountryStats struct {
+	Code            string    `json:"code"  db:"Code"`
+	Name            string    `json:"name"  db:"Name"`
+	Cities          int       `json:"cities"  db:"Cities"`
+	UrbanPopulation int64     `json:"urbanPopulation"  db:"UrbanPopulation"`
+	RefreshedAt     time.Time `json:"refreshedAt"  db:"RefreshedAt"`
+}
+
+type StatsRefreshResponse struct {
+	Countries  int64 `json:"countries"`
+	DurationMs int64 `json:"durationMs"`
+}
+
+// PostStatsRefreshHandler は国ごとの集計 (都市数と都市人口の合計) を計算し直して country_stats に保存する
+// 集計を読む側は毎回JOINしなくて済むように、書き込み時にまとめて計算しておく
+func (h *Handler) PostStatsRefreshHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	start := time.Now()
+
+	var countries int64
+	err := h.withTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM country_stats")
+		if err != nil {
+			return fmt.Errorf("failed to clear country stats: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, `INSERT INTO country_stats (CountryCode, Cities, UrbanPopulation, RefreshedAt)
+			SELECT country.Code, COUNT(city.ID), COALESCE(SUM(city.Population), 0), NOW()
+			FROM country LEFT JOIN city ON city.CountryCode = country.Code
+			GROUP BY country.Code`)
+		if err != nil {
+			return fmt.Errorf("failed to refresh country stats: %w", err)
+		}
+		countries, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger(c).Error("failed to refresh country stats", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, StatsRefreshResponse{
+		Countries:  countries,
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+}
+
+// GetCountryStatsHandler は country_stats に保存された集計を都市数の多い順に返す
+// 集計は POST /admin/stats/refresh を呼んだ時点のもの
+func (h *Handler) GetCountryStatsHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	stats := []CountryStats{}
+	err = h.db.SelectContext(ctx, &stats, `SELECT country.Code, country.Name, country_stats.Cities, country_stats.UrbanPopulation, country_stats.RefreshedAt
+		FROM country_stats JOIN country ON country_stats.CountryCode = country.Code
+		ORDER BY country_stats.Cities DESC, country.Name ASC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get country stats", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, stats)
+}
+
+type ContinentPopulation struct {
+	Continent string `json:"continent"  db:"Continent"`
+	Total     int64  `json:"total"  db:"total"`
+	Countries int    `json:"countries"  db:"countries"`
+}
+
+func (h *Handler) GetContinentPopulationHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	// 大陸の人口の合計はintに収まらないことがあるので int64 で受け取る
+	populations := []ContinentPopulation{}
+	err := h.db.SelectContext(ctx, &populations, "SELECT Continent, SUM(Population) AS total, COUNT(*) AS countries FROM country GROUP BY Continent ORDER BY total DESC")
+	if err != nil {
+		h.logger(c).Error("failed to get continent population", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, populations)
+}
+
+const (
+	defaultTopCitiesLimit        = 10
+	defaultRichestCountriesLimit = 20
+	maxRankingLimit              = 100
+)
+
+// parseRankingLimit はランキングのクエリパラメータ limit を読み取る
+// 省略時は defaultLimit で、maxRankingLimit で頭打ちにする
+func parseRankingLimit(c echo.Context, defaultLimit int) (int, error) {
+	s := c.QueryParam("limit")
+	if s == "" {
+		return defaultLimit, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return min(v, maxRankingLimit), nil
+}
+
+// GetTopCitiesHandler は人口の多い順に limit 件 (デフォルト10件、最大100件) の都市を返す
+// continent を指定するとその大陸の都市だけに絞り込む
+func (h *Handler) GetTopCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	limit, err := parseRankingLimit(c, defaultTopCitiesLimit)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	b := queryBuilder{}
+	if continent := c.QueryParam("continent"); continent != "" {
+		b.where("country.Continent = ?", continent)
+	}
+	query := "SELECT city.* FROM city JOIN country ON city.CountryCode = country.Code" + b.whereClause() + " ORDER BY city.Population DESC, city.ID ASC LIMIT ?"
+	args := append(b.args, limit)
+
+	cities := []City{}
+	err = h.db.SelectContext(ctx, &cities, query, args...)
+	if err != nil {
+		h.logger(c).Error("failed to get top cities", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, cities)
+}
+
+// GetRichestCountriesHandler はGNPの多い順に limit 件 (デフォルト20件、最大100件) の国を返す
+// GNPがNULLの国は最後に並べる。continent を指定するとその大陸の国だけに絞り込む
+func (h *Handler) GetRichestCountriesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	limit, err := parseRankingLimit(c, defaultRichestCountriesLimit)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	b := queryBuilder{}
+	if continent := c.QueryParam("continent"); continent != "" {
+		b.where("Continent = ?", continent)
+	}
+	// MySQLの降順ではNULLが最後になるが、明示するために GNP IS NULL で先に並べ分ける
+	query := "SELECT * FROM country" + b.whereClause() + " ORDER BY GNP IS NULL ASC, GNP DESC, Code ASC LIMIT ?"
+	args := append(b.args, limit)
+
+	countries := []Country{}
+	err = h.db.SelectContext(ctx, &countries, query, args...)
+	if err != nil {
+		h.logger(c).Error("failed to get richest countries", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, countries)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPostStatsRefreshHandler(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM country_stats").WillReturnResult(sqlmock.NewResult(0, 239))
+	// 都市数と都市人口の合計を1つの INSERT ... SELECT で集計する
+	mock.ExpectExec(`INSERT INTO country_stats \(CountryCode, Cities, UrbanPopulation, RefreshedAt\)\s+SELECT country\.Code, COUNT\(city\.ID\), COALESCE\(SUM\(city\.Population\), 0\), NOW\(\)\s+FROM country LEFT JOIN city ON city\.CountryCode = country\.Code\s+GROUP BY country\.Code`).
+		WillReturnResult(sqlmock.NewResult(0, 239))
+	mock.ExpectCommit()
+
+	e := echo.New()
+	e.POST("/admin/stats/refresh", h.PostStatsRefreshHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/stats/refresh", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var res StatsRefreshResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Countries != 239 {
+		t.Errorf("countries = %d, want 239", res.Countries)
+	}
+}
+
+func TestPostStatsRefreshHandlerRollsBack(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM country_stats").WillReturnResult(sqlmock.NewResult(0, 239))
+	mock.ExpectExec("INSERT INTO country_stats").WillReturnError(errors.New("lock wait timeout"))
+	// 集計に失敗したら削除も取り消し、前回の集計を残す
+	mock.ExpectRollback()
+
+	e := echo.New()
+	e.POST("/admin/stats/refresh", h.PostStatsRefreshHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/stats/refresh", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body.String())
+	}
+}
+
+func TestGetCountryStatsHandlerReadsCache(t *testing.T) {
+	refreshedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h, mock := newMockHandler(t)
+	// 読み込みは country_stats の保存済みの集計だけを使い、city を集計し直さない
+	mock.ExpectQuery(`SELECT country\.Code, country\.Name, country_stats\.Cities, country_stats\.UrbanPopulation, country_stats\.RefreshedAt\s+FROM country_stats JOIN country ON country_stats\.CountryCode = country\.Code\s+ORDER BY country_stats\.Cities DESC, country\.Name ASC LIMIT \? OFFSET \?$`).
+		WithArgs(defaultLimit, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"Code", "Name", "Cities", "UrbanPopulation", "RefreshedAt"}).
+			AddRow("CHN", "China", 363, 175953614, refreshedAt).
+			AddRow("IND", "India", 341, 123298526, refreshedAt))
+
+	e := echo.New()
+	e.GET("/stats/countries", h.GetCountryStatsHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/countries", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var stats []CountryStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := []CountryStats{
+		{Code: "CHN", Name: "China", Cities: 363, UrbanPopulation: 175953614, RefreshedAt: refreshedAt},
+		{Code: "IND", Name: "India", Cities: 341, UrbanPopulation: 123298526, RefreshedAt: refreshedAt},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
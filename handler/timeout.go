@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TimeoutConfig struct {
+	// Default は全リクエストに適用するタイムアウト
+	Default time.Duration
+	// Overrides はルートのパターン (例: "/cities/:id") ごとに Default の代わりに使うタイムアウト
+	Overrides map[string]time.Duration
+}
+
+// TimeoutMiddleware はリクエストのcontextにタイムアウトを設定する
+// タイムアウトしたときは503 Service Unavailableを返す
+func TimeoutMiddleware(config TimeoutConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			timeout, ok := config.Overrides[c.Path()]
+			if !ok {
+				timeout = config.Default
+			}
+			if timeout <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+			if errors.Is(err, context.DeadlineExceeded) {
+				return jsonError(c, http.StatusServiceUnavailable, "request timed out")
+			}
+			return err
+		}
+	}
+}
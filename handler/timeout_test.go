@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sleepHandler は d だけ待つか、リクエストのcontextが終わるまで待つ
+func sleepHandler(d time.Duration) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		select {
+		case <-time.After(d):
+			return c.String(http.StatusOK, "done")
+		case <-c.Request().Context().Done():
+			return c.Request().Context().Err()
+		}
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(TimeoutMiddleware(TimeoutConfig{
+		Default: 20 * time.Millisecond,
+		Overrides: map[string]time.Duration{
+			"/slow/:id": time.Second,
+			"/nolimit":  0,
+		},
+	}))
+	e.GET("/fast", sleepHandler(0))
+	e.GET("/sleep", sleepHandler(200*time.Millisecond))
+	e.GET("/slow/:id", sleepHandler(50*time.Millisecond))
+	e.GET("/nolimit", sleepHandler(50*time.Millisecond))
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "within default", target: "/fast", want: http.StatusOK},
+		{name: "past default deadline", target: "/sleep", want: http.StatusServiceUnavailable},
+		{name: "override extends deadline", target: "/slow/1", want: http.StatusOK},
+		{name: "override disables timeout", target: "/nolimit", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusServiceUnavailable {
+				return
+			}
+
+			var res ErrorResponse
+			err := json.Unmarshal(rec.Body.Bytes(), &res)
+			if err != nil {
+				t.Fatalf("body is not JSON: %q", rec.Body.String())
+			}
+			if res.Error != "request timed out" || res.Status != http.StatusServiceUnavailable {
+				t.Errorf("body = %+v", res)
+			}
+		})
+	}
+}
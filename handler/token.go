@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// tokenLifetime はセッションから発行するトークンの有効期間
+const tokenLifetime = 5 * time.Minute
+
+// tokenSigningMethod はトークンの署名方式。検証ではこれ以外の方式のトークンを拒否する
+var tokenSigningMethod = jwt.SigningMethodHS256
+
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// GetMeTokenHandler はログイン中のユーザーを表す短期間有効なJWTを発行する
+// Cookieを読めない他のサービスやWebSocketの接続に、セッションの代わりに渡すためのもの
+func (h *Handler) GetMeTokenHandler(c echo.Context) error {
+	token, expiresAt, err := h.signToken(c.Get("userName").(string), time.Now())
+	if err != nil {
+		h.logger(c).Error("failed to sign token", "error", err)
+		return internalError(c, err)
+	}
+
+	return respondJSON(c, http.StatusOK, TokenResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+// signToken は now から tokenLifetime の間有効な userName のトークンを発行する
+func (h *Handler) signToken(userName string, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(tokenLifetime)
+	claims := jwt.RegisteredClaims{
+		Subject:   userName,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(tokenSigningMethod, claims).SignedString(h.TokenSigningKey)
+	return token, expiresAt, err
+}
+
+// verifyToken はトークンの署名・署名方式・有効期限を確認し、トークンが表すユーザー名を返す
+func (h *Handler) verifyToken(tokenString string) (string, error) {
+	if len(h.TokenSigningKey) == 0 {
+		return "", errors.New("token authentication is disabled")
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return h.TokenSigningKey, nil
+	}, jwt.WithValidMethods([]string{tokenSigningMethod.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+// bearerToken は Authorization: Bearer ヘッダーのトークンを返す
+func bearerToken(c echo.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// IsBearerRequest は Authorization: Bearer ヘッダーで認証するリクエストかを返す
+// ブラウザはこのヘッダーを自動で付けないので、CSRFの確認は不要になる
+func IsBearerRequest(c echo.Context) bool {
+	_, ok := bearerToken(c)
+	return ok
+}
+
+// AuthMiddleware は Authorization: Bearer ヘッダーのトークンか、セッションでユーザーを認証する
+// トークンが付いている場合はセッションを見ずに、トークンが有効かだけを確認する
+func (h *Handler) AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	withSession := UserAuthMiddleware(next)
+	return func(c echo.Context) error {
+		token, ok := bearerToken(c)
+		if !ok {
+			return withSession(c)
+		}
+		userName, err := h.verifyToken(token)
+		if err != nil {
+			return jsonError(c, http.StatusUnauthorized, "invalid token")
+		}
+		c.Set("userName", userName)
+		return next(c)
+	}
+}
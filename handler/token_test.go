@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSignAndVerifyToken(t *testing.T) {
+	h := &Handler{TokenSigningKey: []byte("secret")}
+	now := time.Now()
+
+	valid, _, err := h.signToken("alice", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := h.signToken("alice", now.Add(-2*tokenLifetime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := (&Handler{TokenSigningKey: []byte("other")}).signToken("alice", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherMethod, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.RegisteredClaims{
+		Subject:   "alice",
+		ExpiresAt: jwt.NewNumericDate(now.Add(tokenLifetime)),
+	}).SignedString(h.TokenSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{
+		Subject:   "alice",
+		ExpiresAt: jwt.NewNumericDate(now.Add(tokenLifetime)),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noExpiry, err := jwt.NewWithClaims(tokenSigningMethod, jwt.RegisteredClaims{Subject: "alice"}).SignedString(h.TokenSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: valid},
+		{name: "expired", token: expired, wantErr: true},
+		{name: "signed with another key", token: otherKey, wantErr: true},
+		{name: "another signing method", token: otherMethod, wantErr: true},
+		{name: "unsigned", token: unsigned, wantErr: true},
+		{name: "without expiry", token: noExpiry, wantErr: true},
+		{name: "malformed", token: "not a token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userName, err := h.verifyToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("verifyToken() = %q, want error", userName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyToken() error = %v", err)
+			}
+			if userName != "alice" {
+				t.Fatalf("verifyToken() = %q, want %q", userName, "alice")
+			}
+		})
+	}
+}
+
+func TestVerifyTokenWithoutSigningKey(t *testing.T) {
+	token, _, err := (&Handler{TokenSigningKey: []byte("secret")}).signToken("alice", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Handler{}).verifyToken(token)
+	if err == nil {
+		t.Fatal("verifyToken() error = nil, want error when TOKEN_SECRET is not set")
+	}
+}
+
+func TestMintedTokenPassesAuthMiddleware(t *testing.T) {
+	h := &Handler{TokenSigningKey: []byte("secret")}
+	e := echo.New()
+	e.GET("/me/token", h.GetMeTokenHandler, withUser("alice"))
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get("userName").(string))
+	}, h.AuthMiddleware)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me/token", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /me/token status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var res TokenResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatalf("body is not JSON: %q", rec.Body.String())
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{name: "minted token", authorization: "Bearer " + res.Token, want: http.StatusOK},
+		{name: "lower case scheme", authorization: "bearer " + res.Token, want: http.StatusOK},
+		{name: "tampered token", authorization: "Bearer " + res.Token + "x", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && rec.Body.String() != "alice" {
+				t.Errorf("userName = %q, want %q", rec.Body.String(), "alice")
+			}
+		})
+	}
+}
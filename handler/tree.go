@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+type ContinentNode struct {
+	Continent string        `json:"continent"`
+	Countries []CountryNode `json:"countries"`
+}
+
+type CountryNode struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Cities []City `json:"cities"`
+}
+
+type cityTreeRow struct {
+	Continent   string         `db:"Continent"`
+	CountryCode string         `db:"CountryCode"`
+	CountryName string         `db:"CountryName"`
+	CityID      sql.NullInt64  `db:"CityID"`
+	CityName    sql.NullString `db:"CityName"`
+	District    sql.NullString `db:"District"`
+	Population  sql.NullInt64  `db:"Population"`
+}
+
+// GetCityTreeHandler は大陸 > 国 > 都市 の入れ子で都市を返す
+// ページングは大陸単位で行い、1回のクエリで取得した行をGoで組み立てる
+func (h *Handler) GetCityTreeHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	var continents []string
+	err = h.db.SelectContext(ctx, &continents, "SELECT DISTINCT Continent FROM country ORDER BY Continent ASC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		h.logger(c).Error("failed to get continents", "error", err)
+		return internalError(c, err)
+	}
+	tree := []ContinentNode{}
+	if len(continents) == 0 {
+		return respondJSON(c, http.StatusOK, tree)
+	}
+
+	// 都市のない国も含めるためにLEFT JOINする
+	query, args, err := sqlx.In(`SELECT country.Continent, country.Code AS CountryCode, country.Name AS CountryName,
+			city.ID AS CityID, city.Name AS CityName, city.District, city.Population
+		FROM country LEFT JOIN city ON city.CountryCode = country.Code
+		WHERE country.Continent IN (?)
+		ORDER BY country.Continent ASC, country.Name ASC, city.Name ASC, city.ID ASC`, continents)
+	if err != nil {
+		h.logger(c).Error("failed to build city tree query", "error", err)
+		return internalError(c, err)
+	}
+	var rows []cityTreeRow
+	err = h.db.SelectContext(ctx, &rows, h.db.Rebind(query), args...)
+	if err != nil {
+		h.logger(c).Error("failed to get city tree", "error", err)
+		return internalError(c, err)
+	}
+
+	for _, row := range rows {
+		if len(tree) == 0 || tree[len(tree)-1].Continent != row.Continent {
+			tree = append(tree, ContinentNode{Continent: row.Continent, Countries: []CountryNode{}})
+		}
+		continent := &tree[len(tree)-1]
+		if len(continent.Countries) == 0 || continent.Countries[len(continent.Countries)-1].Code != row.CountryCode {
+			continent.Countries = append(continent.Countries, CountryNode{Code: row.CountryCode, Name: row.CountryName, Cities: []City{}})
+		}
+		country := &continent.Countries[len(continent.Countries)-1]
+		if row.CityID.Valid {
+			country.Cities = append(country.Cities, City{
+				ID:          int(row.CityID.Int64),
+				Name:        row.CityName,
+				CountryCode: sql.NullString{String: row.CountryCode, Valid: true},
+				District:    row.District,
+				Population:  row.Population,
+			})
+		}
+	}
+
+	return respondJSON(c, http.StatusOK, tree)
+}
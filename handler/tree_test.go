@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetCityTreeHandler(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery(`SELECT DISTINCT Continent FROM country ORDER BY Continent ASC LIMIT \? OFFSET \?`).
+		WithArgs(2, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"Continent"}).AddRow("Antarctica").AddRow("Asia"))
+	mock.ExpectQuery(`FROM country LEFT JOIN city ON city\.CountryCode = country\.Code\s+WHERE country\.Continent IN \(\?, \?\)`).
+		WithArgs("Antarctica", "Asia").
+		WillReturnRows(sqlmock.NewRows([]string{"Continent", "CountryCode", "CountryName", "CityID", "CityName", "District", "Population"}).
+			// 都市のない国は LEFT JOIN で都市のカラムがNULLになる
+			AddRow("Antarctica", "ATA", "Antarctica", nil, nil, nil, nil).
+			AddRow("Asia", "CHN", "China", 10, "Beijing", "Peking", 7472000).
+			AddRow("Asia", "CHN", "China", 11, "Shanghai", "Shanghai", 9696300).
+			AddRow("Asia", "JPN", "Japan", 20, "Tokyo", "Tokyo-to", 7980230))
+
+	e := echo.New()
+	e.GET("/tree/cities", h.GetCityTreeHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tree/cities?limit=2", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var tree []ContinentNode
+	if err := json.Unmarshal(rec.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	// 大陸 > 国 > 都市 の数を確かめる
+	type shape struct {
+		continent string
+		cities    map[string]int
+	}
+	want := []shape{
+		{continent: "Antarctica", cities: map[string]int{"ATA": 0}},
+		{continent: "Asia", cities: map[string]int{"CHN": 2, "JPN": 1}},
+	}
+	if len(tree) != len(want) {
+		t.Fatalf("continents = %d, want %d: %+v", len(tree), len(want), tree)
+	}
+	for i, w := range want {
+		if tree[i].Continent != w.continent {
+			t.Errorf("tree[%d].continent = %q, want %q", i, tree[i].Continent, w.continent)
+		}
+		if len(tree[i].Countries) != len(w.cities) {
+			t.Errorf("%s countries = %d, want %d", w.continent, len(tree[i].Countries), len(w.cities))
+			continue
+		}
+		for _, country := range tree[i].Countries {
+			if country.Cities == nil {
+				t.Errorf("%s cities is null, want an array", country.Code)
+			}
+			if got, ok := w.cities[country.Code]; !ok || len(country.Cities) != got {
+				t.Errorf("%s cities = %d, want %d", country.Code, len(country.Cities), got)
+			}
+		}
+	}
+	if city := tree[1].Countries[0].Cities[1]; city.ID != 11 || city.CountryCode.String != "CHN" {
+		t.Errorf("Shanghai = %+v, want ID 11 in CHN", city)
+	}
+}
+
+func TestGetCityTreeHandlerEmpty(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery("SELECT DISTINCT Continent FROM country").
+		WithArgs(defaultLimit, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"Continent"}))
+
+	e := echo.New()
+	e.GET("/tree/cities", h.GetCityTreeHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tree/cities?offset=100", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("body = %q, want []", body)
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// withTx はトランザクションの中で fn を実行する
+// fn がエラーを返すかpanicしたらロールバックし、そうでなければコミットする
+// panicはロールバックした後にそのまま呼び出し元に伝える
+func (h *Handler) withTx(ctx context.Context, fn func(*sqlx.Tx) error) (err error) {
+	tx, err := h.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %s)", err, rbErr)
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
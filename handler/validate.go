@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBulkCities は一括登録・一括検証で一度に受け付ける都市の最大件数
+const maxBulkCities = 1000
+
+type CityValidationResult struct {
+	Index  int      `json:"index"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// city テーブルの Name と District の最大文字数 (CHAR(35) と CHAR(20))
+const (
+	maxCityNameLength     = 35
+	maxCityDistrictLength = 20
+)
+
+// validateCityInput はDBを見ずに確認できる項目を検証する
+func validateCityInput(city CityInput) error {
+	if city.Name == "" {
+		return errors.New("name is empty")
+	}
+	if utf8.RuneCountInString(city.Name) > maxCityNameLength {
+		return errors.New("name must be at most " + strconv.Itoa(maxCityNameLength) + " characters")
+	}
+	if len(city.CountryCode) != 3 {
+		return errors.New("countryCode must be 3 letters")
+	}
+	if utf8.RuneCountInString(city.District) > maxCityDistrictLength {
+		return errors.New("district must be at most " + strconv.Itoa(maxCityDistrictLength) + " characters")
+	}
+	if city.Population < 0 {
+		return errors.New("population must not be negative")
+	}
+	return nil
+}
+
+// existingCountryCodes は codes のうち country テーブルに存在するものを返す
+func (h *Handler) existingCountryCodes(ctx context.Context, codes []string) (map[string]bool, error) {
+	exists := map[string]bool{}
+	if len(codes) == 0 {
+		return exists, nil
+	}
+
+	query, args, err := sqlx.In("SELECT Code FROM country WHERE Code IN (?)", codes)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	err = h.db.SelectContext(ctx, &found, h.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range found {
+		exists[code] = true
+	}
+	return exists, nil
+}
+
+// cityKey は UniqueCityPerDistrict で重複を判定する都市の組
+type cityKey struct {
+	Name        string `db:"Name"`
+	CountryCode string `db:"CountryCode"`
+	District    string `db:"District"`
+}
+
+// foldCityKey は照合順序と同じく大文字小文字を区別せずに比較できるよう、key を小文字にそろえる
+func foldCityKey(key cityKey) cityKey {
+	return cityKey{strings.ToLower(key.Name), strings.ToLower(key.CountryCode), strings.ToLower(key.District)}
+}
+
+// existingCities は keys のうち city テーブルに既に登録されているものを返す
+// 結果のキーは foldCityKey で小文字にそろえてある
+func (h *Handler) existingCities(ctx context.Context, keys []cityKey) (map[cityKey]bool, error) {
+	exists := map[cityKey]bool{}
+	if len(keys) == 0 {
+		return exists, nil
+	}
+
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, 0, len(keys)*3)
+	for i, key := range keys {
+		placeholders[i] = "(?, ?, ?)"
+		args = append(args, key.Name, key.CountryCode, key.District)
+	}
+	var found []cityKey
+	err := h.db.SelectContext(ctx, &found, "SELECT Name, CountryCode, District FROM city WHERE (Name, CountryCode, District) IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range found {
+		exists[foldCityKey(key)] = true
+	}
+	return exists, nil
+}
+
+// validateCities は一括登録と同じ検証を行い、行ごとの結果を返す
+// 項目の検証、国コードの存在確認、一括データ内での重複確認を行い、
+// UniqueCityPerDistrict が有効なら登録済みの都市との重複も確認する
+func (h *Handler) validateCities(ctx context.Context, cities []CityInput) ([]CityValidationResult, error) {
+	codes := []string{}
+	keys := []cityKey{}
+	for _, city := range cities {
+		codes = append(codes, city.CountryCode)
+		keys = append(keys, cityKey{city.Name, city.CountryCode, city.District})
+	}
+	countries, err := h.existingCountryCodes(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+	registered := map[cityKey]bool{}
+	if h.UniqueCityPerDistrict {
+		registered, err = h.existingCities(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[cityKey]int{}
+
+	results := make([]CityValidationResult, len(cities))
+	for i, city := range cities {
+		result := CityValidationResult{Index: i, Errors: []string{}}
+		if err := validateCityInput(city); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else if !countries[city.CountryCode] {
+			result.Errors = append(result.Errors, "countryCode does not exist")
+		}
+
+		// 登録済みの都市との比較と同じく、大文字小文字だけが違う都市も重複とみなす
+		key := foldCityKey(keys[i])
+		if j, ok := seen[key]; ok {
+			result.Errors = append(result.Errors, "duplicate of index "+strconv.Itoa(j))
+		} else {
+			seen[key] = i
+		}
+
+		if registered[key] {
+			result.Errors = append(result.Errors, "city already exists in the district")
+		}
+
+		result.Valid = len(result.Errors) == 0
+		results[i] = result
+	}
+	return results, nil
+}
+
+type CityValidationResponse struct {
+	Valid   bool                   `json:"valid"`
+	Results []CityValidationResult `json:"results"`
+}
+
+func (h *Handler) ValidateCitiesHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var cities []CityInput
+	err := c.Bind(&cities)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+	if len(cities) > maxBulkCities {
+		return jsonError(c, http.StatusBadRequest, "too many cities (max "+strconv.Itoa(maxBulkCities)+")")
+	}
+
+	results, err := h.validateCities(ctx, cities)
+	if err != nil {
+		h.logger(c).Error("failed to validate cities", "error", err)
+		return internalError(c, err)
+	}
+
+	res := CityValidationResponse{Valid: true, Results: results}
+	for _, result := range results {
+		if !result.Valid {
+			res.Valid = false
+		}
+	}
+
+	return respondJSON(c, http.StatusOK, res)
+}
+
+type BulkValidationError struct {
+	ErrorResponse
+	Index  int      `json:"index"`
+	Errors []string `json:"errors"`
+}
+
+type BulkInsertResponse struct {
+	Inserted int   `json:"inserted"`
+	IDs      []int `json:"ids"`
+}
+
+// PostCitiesBulkHandler は都市の配列を1つのトランザクションでまとめて登録する
+// 1件でも検証に失敗したら何も登録せず、最初に失敗した要素の index を付けて400を返す
+func (h *Handler) PostCitiesBulkHandler(c echo.Context) error {
+	ctx, cancel := dbContext(c)
+	defer cancel()
+
+	var cities []CityInput
+	err := c.Bind(&cities)
+	if err != nil {
+		return bodyError(c, err, "bad request body")
+	}
+	if len(cities) == 0 {
+		return jsonError(c, http.StatusBadRequest, "no cities")
+	}
+	if len(cities) > maxBulkCities {
+		return jsonError(c, http.StatusBadRequest, "too many cities (max "+strconv.Itoa(maxBulkCities)+")")
+	}
+
+	results, err := h.validateCities(ctx, cities)
+	if err != nil {
+		h.logger(c).Error("failed to validate cities", "error", err)
+		return internalError(c, err)
+	}
+	for _, result := range results {
+		if !result.Valid {
+			return c.JSON(http.StatusBadRequest, BulkValidationError{
+				ErrorResponse: ErrorResponse{Error: "invalid city at index " + strconv.Itoa(result.Index), Status: http.StatusBadRequest},
+				Index:         result.Index,
+				Errors:        result.Errors,
+			})
+		}
+	}
+
+	var ids []int
+	userName := c.Get("userName").(string)
+	err = h.withTx(ctx, func(tx *sqlx.Tx) error {
+		ids, err = insertCities(ctx, tx, cities, userName)
+		return err
+	})
+	if err != nil {
+		h.logger(c).Error("failed to insert cities", "error", err)
+		return internalError(c, err)
+	}
+
+	h.auditCities(userName, "create", ids)
+
+	for i, city := range cities {
+		city.ID = ids[i]
+		h.hub.Publish("created", city)
+	}
+
+	return respondJSON(c, http.StatusCreated, BulkInsertResponse{Inserted: len(ids), IDs: ids})
+}
+
+// insertCities は cities を1行ずつ登録し、人口の履歴をまとめて記録する
+// 登録した都市のIDを cities と同じ順で返す
+// 複数行のINSERTではIDが連続するとは限らない (auto_increment_increment やロックモード次第) ので、
+// 行ごとに LastInsertId でIDを取得する
+func insertCities(ctx context.Context, tx *sqlx.Tx, cities []CityInput, userName string) ([]int, error) {
+	ids := make([]int, len(cities))
+	for i, city := range cities {
+		result, err := tx.ExecContext(ctx, "INSERT INTO city (Name, CountryCode, District, Population, CreatedBy) VALUES (?, ?, ?, ?, ?)",
+			city.Name, city.CountryCode, city.District, city.Population, userName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert cities: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get last insert id: %w", err)
+		}
+		ids[i] = int(id)
+	}
+
+	if len(cities) == 0 {
+		return ids, nil
+	}
+	placeholders := make([]string, len(cities))
+	args := make([]interface{}, 0, len(cities)*2)
+	for i, city := range cities {
+		placeholders[i] = "(?, ?)"
+		args = append(args, ids[i], city.Population)
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO city_population_history (CityID, Population) VALUES "+strings.Join(placeholders, ", "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record population history: %w", err)
+	}
+	return ids, nil
+}
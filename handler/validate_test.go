@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+func TestValidateCityInput(t *testing.T) {
+	valid := CityInput{Name: "Tokyo", CountryCode: "JPN", District: "Tokyo-to", Population: 7980230}
+
+	tests := []struct {
+		name    string
+		modify  func(*CityInput)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(c *CityInput) {}},
+		{name: "zero population", modify: func(c *CityInput) { c.Population = 0 }},
+		{name: "empty district", modify: func(c *CityInput) { c.District = "" }},
+		{name: "name at limit", modify: func(c *CityInput) { c.Name = strings.Repeat("a", maxCityNameLength) }},
+		{name: "multibyte name at limit", modify: func(c *CityInput) { c.Name = strings.Repeat("東", maxCityNameLength) }},
+		{name: "district at limit", modify: func(c *CityInput) { c.District = strings.Repeat("a", maxCityDistrictLength) }},
+		{name: "empty name", modify: func(c *CityInput) { c.Name = "" }, wantErr: true},
+		{name: "name too long", modify: func(c *CityInput) { c.Name = strings.Repeat("a", maxCityNameLength+1) }, wantErr: true},
+		{name: "district too long", modify: func(c *CityInput) { c.District = strings.Repeat("a", maxCityDistrictLength+1) }, wantErr: true},
+		{name: "short country code", modify: func(c *CityInput) { c.CountryCode = "JP" }, wantErr: true},
+		{name: "negative population", modify: func(c *CityInput) { c.Population = -1 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			city := valid
+			tt.modify(&city)
+			err := validateCityInput(city)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCityInput(%+v) error = %v, wantErr %v", city, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFoldCityKey(t *testing.T) {
+	a := foldCityKey(cityKey{Name: "Tokyo", CountryCode: "JPN", District: "Tokyo-to"})
+	b := foldCityKey(cityKey{Name: "TOKYO", CountryCode: "jpn", District: "tokyo-TO"})
+	if a != b {
+		t.Fatalf("foldCityKey() = %+v and %+v, want equal", a, b)
+	}
+}
+
+func TestValidateCitiesHandler(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+		WithArgs("JPN", "JPN", "JPN", "XXX", "JPN").
+		WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+
+	e := echo.New()
+	e.POST("/cities/validate", h.ValidateCitiesHandler, withUser("alice"))
+	rec := serveJSON(e, http.MethodPost, "/cities/validate", `[
+		{"name": "Tokyo", "countryCode": "JPN", "district": "Tokyo-to", "population": 100},
+		{"name": "TOKYO", "countryCode": "JPN", "district": "tokyo-to", "population": 200},
+		{"name": "Osaka", "countryCode": "JPN", "district": "Osaka", "population": -1},
+		{"name": "Nowhere", "countryCode": "XXX", "district": "", "population": 1},
+		{"name": "Kyoto", "countryCode": "JPN", "district": "Kyoto", "population": 1}
+	]`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var res CityValidationResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Valid {
+		t.Error("valid = true, want false")
+	}
+
+	want := []CityValidationResult{
+		{Index: 0, Valid: true, Errors: []string{}},
+		{Index: 1, Valid: false, Errors: []string{"duplicate of index 0"}},
+		{Index: 2, Valid: false, Errors: []string{"population must not be negative"}},
+		{Index: 3, Valid: false, Errors: []string{"countryCode does not exist"}},
+		{Index: 4, Valid: true, Errors: []string{}},
+	}
+	if !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("results = %+v, want %+v", res.Results, want)
+	}
+}
+
+func TestValidateCitiesHandlerAllValid(t *testing.T) {
+	h, mock := newMockHandler(t)
+	mock.ExpectQuery("SELECT Code FROM country WHERE Code IN").
+		WithArgs("JPN", "JPN").
+		WillReturnRows(sqlmock.NewRows([]string{"Code"}).AddRow("JPN"))
+
+	e := echo.New()
+	e.POST("/cities/validate", h.ValidateCitiesHandler, withUser("alice"))
+	rec := serveJSON(e, http.MethodPost, "/cities/validate", `[
+		{"name": "Tokyo", "countryCode": "JPN", "district": "Tokyo-to", "population": 100},
+		{"name": "Tokyo", "countryCode": "JPN", "district": "Chiba", "population": 100}
+	]`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var res CityValidationResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid {
+		t.Errorf("valid = false, want true: %+v", res.Results)
+	}
+}
+
+func TestInsertCitiesUsesEachInsertID(t *testing.T) {
+	h, mock := newMockHandler(t)
+	cities := []CityInput{
+		{Name: "Tokyo", CountryCode: "JPN", District: "Tokyo-to", Population: 100},
+		{Name: "Osaka", CountryCode: "JPN", District: "Osaka", Population: 200},
+		{Name: "Kyoto", CountryCode: "JPN", District: "Kyoto", Population: 0},
+	}
+
+	// auto_increment_increment が1でないなど、IDが連続しない場合
+	mock.ExpectBegin()
+	for i, id := range []int64{10, 13, 16} {
+		city := cities[i]
+		mock.ExpectExec(`INSERT INTO city \(Name, CountryCode, District, Population, CreatedBy\) VALUES \(\?, \?, \?, \?, \?\)$`).
+			WithArgs(city.Name, city.CountryCode, city.District, city.Population, "alice").
+			WillReturnResult(sqlmock.NewResult(id, 1))
+	}
+	mock.ExpectExec(`INSERT INTO city_population_history \(CityID, Population\) VALUES \(\?, \?\), \(\?, \?\), \(\?, \?\)$`).
+		WithArgs(10, 100, 13, 200, 16, 0).
+		WillReturnResult(sqlmock.NewResult(1, 3))
+	mock.ExpectCommit()
+
+	var ids []int
+	err := h.withTx(context.Background(), func(tx *sqlx.Tx) error {
+		var err error
+		ids, err = insertCities(context.Background(), tx, cities, "alice")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{10, 13, 16}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type searchIndex struct {
+	Name   string
+	Table  string
+	Column string
+}
+
+// 名前検索や前方一致検索で使うカラムに張るインデックス
+var searchIndexes = []searchIndex{
+	{Name: "idx_city_name", Table: "city", Column: "Name"},
+	{Name: "idx_country_name", Table: "country", Column: "Name"},
+	{Name: "idx_city_country_code", Table: "city", Column: "CountryCode"},
+}
+
+// ensureSearchIndexes は searchIndexes のうち存在しないものを作成する
+// MySQLは CREATE INDEX IF NOT EXISTS に対応していないので、
+// 先頭カラムが一致するインデックスがあるかを information_schema で確認してから作成する
+func ensureSearchIndexes(db *sqlx.DB) error {
+	for _, idx := range searchIndexes {
+		var count int
+		err := db.Get(&count, "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ? AND SEQ_IN_INDEX = 1", idx.Table, idx.Column)
+		if err != nil {
+			return fmt.Errorf("failed to check index %s: %w", idx.Name, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", idx.Name, idx.Table, idx.Column))
+		if err != nil {
+			return fmt.Errorf("failed to create index %s: %w", idx.Name, err)
+		}
+		slog.Info("created index", "index", idx.Name, "table", idx.Table, "column", idx.Column)
+	}
+	return nil
+}
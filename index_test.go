@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+// newMockDB は sqlmock のDBを返し、テストの終わりに期待どおりのクエリが実行されたかを確認する
+func newMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return sqlx.NewDb(db, "mysql"), mock
+}
+
+func TestEnsureSearchIndexesCreatesOnlyMissing(t *testing.T) {
+	db, mock := newMockDB(t)
+	existing := map[string]int{"idx_city_name": 1, "idx_country_name": 0, "idx_city_country_code": 0}
+	for _, idx := range searchIndexes {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema\.STATISTICS`).
+			WithArgs(idx.Table, idx.Column).
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(existing[idx.Name]))
+		if existing[idx.Name] == 0 {
+			mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX " + idx.Name + " ON " + idx.Table + " (" + idx.Column + ")")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+
+	if err := ensureSearchIndexes(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureSearchIndexesAllExist(t *testing.T) {
+	db, mock := newMockDB(t)
+	// 既にあるインデックスは作らないので、CREATE INDEX を期待しない
+	for _, idx := range searchIndexes {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema\.STATISTICS`).
+			WithArgs(idx.Table, idx.Column).
+			WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	}
+
+	if err := ensureSearchIndexes(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureSearchIndexesReturnsCreateError(t *testing.T) {
+	db, mock := newMockDB(t)
+	idx := searchIndexes[0]
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema\.STATISTICS`).
+		WithArgs(idx.Table, idx.Column).
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mock.ExpectExec("CREATE INDEX " + idx.Name).WillReturnError(errors.New("permission denied"))
+
+	err := ensureSearchIndexes(db)
+	if err == nil {
+		t.Fatal("ensureSearchIndexes() error = nil, want error")
+	}
+}
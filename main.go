@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/srinathgs/mysqlstore"
+	"github.com/traPtitech/naro-template-backend/config"
 	"github.com/traPtitech/naro-template-backend/handler"
 
 	"github.com/go-sql-driver/mysql"
@@ -18,6 +25,9 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// shutdownTimeout は終了時に処理中のリクエストが終わるのを待つ時間の上限
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// .envファイルから環境変数を読み込み
 	err := godotenv.Load(".env")
@@ -25,17 +35,27 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// 環境変数から設定を読み込む
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ログレベルを設定する
+	// LOG_LEVELにdebugを指定するとデバッグ用のログも出力する
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel})))
+
 	// データーベースの設定
 	jst, err := time.LoadLocation("Asia/Tokyo")
 	if err != nil {
 		log.Fatal(err)
 	}
 	conf := mysql.Config{
-		User:      os.Getenv("DB_USERNAME"),
-		Passwd:    os.Getenv("DB_PASSWORD"),
+		User:      cfg.DBUser,
+		Passwd:    cfg.DBPassword,
 		Net:       "tcp",
-		Addr:      os.Getenv("DB_HOSTNAME") + ":" + os.Getenv("DB_PORT"),
-		DBName:    os.Getenv("DB_DATABASE"),
+		Addr:      cfg.DBHost + ":" + cfg.DBPort,
+		DBName:    cfg.DBName,
 		ParseTime: true,
 		Collation: "utf8mb4_unicode_ci",
 		Loc:       jst,
@@ -47,37 +67,382 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// コネクションプールの大きさを制限する
+	// 制限しないと負荷が高いときにコネクションを開き続け、MySQLの max_connections を使い切ってしまう
+	// 待機中のコネクションは少しだけ残して再利用し、残りは閉じてMySQL側の資源を空ける
+	// MySQLやロードバランサーに切られる前に、古いコネクションは自分から閉じて作り直す
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
 	// usersテーブルが存在しなかったら、usersテーブルを作成する
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS users (Username VARCHAR(255) PRIMARY KEY, HashedPass VARCHAR(255))")
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS users (Username VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci PRIMARY KEY, HashedPass VARCHAR(255))")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ユーザー名は大文字小文字を区別せずに一意にする
+	// 照合順序が大文字小文字を区別するものだと "Alice" と "alice" を両方登録できてしまうので、既存のテーブルも変更する
+	err = ensureColumnCollation(db, "users", "Username", "VARCHAR(255) CHARACTER SET utf8mb4 NOT NULL", "utf8mb4_unicode_ci")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// usersテーブルに管理者かどうかのカラムを追加する
+	// 管理者にするには、データベースで直接 IsAdmin を TRUE にする
+	_, err = ensureColumn(db, "users", "IsAdmin", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// usersテーブルに登録日時のカラムを追加する
+	// 既存のユーザーの登録日時は分からないのでNULLのままにし、追加してからデフォルト値を設定する
+	added, err := ensureColumn(db, "users", "CreatedAt", "DATETIME NULL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if added {
+		_, err = db.Exec("ALTER TABLE users MODIFY CreatedAt DATETIME NULL DEFAULT CURRENT_TIMESTAMP")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// 国名の翻訳を保存するテーブルを作成する
+	// 翻訳がない国は country テーブルの英語名を使う
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS country_translation (CountryCode CHAR(3) NOT NULL, Language VARCHAR(16) NOT NULL, Name VARCHAR(255) NOT NULL, PRIMARY KEY (CountryCode, Language))")
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// 都市の人口の履歴を保存するテーブルを作成する
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS city_population_history (ID INT AUTO_INCREMENT PRIMARY KEY, CityID INT NOT NULL, Population INT NOT NULL, RecordedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, INDEX (CityID))")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// cityテーブルのスナップショットを保存するテーブルを作成する
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS city_snapshot (SnapshotName VARCHAR(64) NOT NULL, ID INT NOT NULL, Name CHAR(35) NOT NULL, CountryCode CHAR(3) NOT NULL, District CHAR(20) NOT NULL, Population INT NOT NULL, PRIMARY KEY (SnapshotName, ID))")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 国ごとの集計を保存するテーブルを作成する
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS country_stats (CountryCode CHAR(3) PRIMARY KEY, Cities INT NOT NULL, UrbanPopulation BIGINT NOT NULL, RefreshedAt DATETIME NOT NULL)")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 都市の緯度・経度を保存するテーブルを作成する
+	// world データベースには位置の情報がないので、必要な都市だけ別に登録する
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS city_location (CityID INT PRIMARY KEY, Latitude DOUBLE NOT NULL, Longitude DOUBLE NOT NULL)")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ユーザーのお気に入りの都市を保存するテーブルを作成する
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS user_favorites (Username VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL, CityID INT NOT NULL, CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (Username, CityID))")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 誰がどのデータを変更したかを記録する監査ログのテーブルを作成する
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS audit_log (ID INT AUTO_INCREMENT PRIMARY KEY, Username VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL, Action VARCHAR(32) NOT NULL, Target VARCHAR(255) NOT NULL, CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, INDEX (CreatedAt))")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// users.Username と比較するカラムの照合順序をそろえる
+	// 照合順序が異なるカラム同士を比較すると、MySQLは Illegal mix of collations (1267) で拒否する
+	for _, table := range []string{"user_favorites", "audit_log"} {
+		err = ensureColumnCollation(db, table, "Username", "VARCHAR(255) CHARACTER SET utf8mb4 NOT NULL", "utf8mb4_unicode_ci")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// cityテーブルに作成日時のカラムを追加する
+	// 既存の行はNULLのままにしたいので、追加してからデフォルト値を設定する
+	added, err = ensureColumn(db, "city", "CreatedAt", "DATETIME NULL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if added {
+		_, err = db.Exec("ALTER TABLE city MODIFY CreatedAt DATETIME NULL DEFAULT CURRENT_TIMESTAMP")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// cityテーブルに作成したユーザーのカラムを追加する
+	// 既存の行は誰が作成したか分からないのでNULLのままにする
+	_, err = ensureColumn(db, "city", "CreatedBy", "VARCHAR(255) NULL")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// DB_CREATE_INDEXESがtrueなら、検索で使うカラムにインデックスを作成する
+	if cfg.DBCreateIndexes {
+		err = ensureSearchIndexes(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// セッションの情報を記憶するための場所をデータベース上に設定
-	store, err := mysqlstore.NewMySQLStoreFromConnection(db.DB, "sessions", "/", 60*60*24*14, []byte("secret-token"))
+	store, err := mysqlstore.NewMySQLStoreFromConnection(db.DB, "sessions", "/", int(handler.SessionTimeout/time.Second), []byte(cfg.SessionSecret))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	h := handler.NewHandler(db)
+	h := handler.NewHandler(db, cfg)
+
+	// テーブルのカラムが構造体と食い違っていないかを確認する
+	// SCHEMA_CHECK_STRICTがtrueなら、食い違いがあったときに起動を中止する
+	problems, err := h.CheckSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, problem := range problems {
+		slog.Warn("schema drift", "problem", problem)
+	}
+	if len(problems) > 0 && cfg.SchemaCheckStrict {
+		log.Fatal("schema drift detected")
+	}
 	e := echo.New()
-	e.Use(middleware.Logger())       // ログを取るミドルウェアを追加
+	e.HTTPErrorHandler = handler.ErrorHandler
+
+	// ログを取るミドルウェアを追加
+	// ACCESS_LOG_FILEが設定されていれば、標準出力に加えてファイルにも書き込む
+	// ファイルはACCESS_LOG_MAX_SIZE (バイト、デフォルト10MB) を超えるとローテーションし、
+	// ローテーションしたファイルは新しいものからACCESS_LOG_MAX_BACKUPS個 (デフォルト5、0なら全て) 残す
+	var accessLog io.Writer = os.Stdout
+	if cfg.AccessLogFile != "" {
+		file, err := newRotatingFile(cfg.AccessLogFile, cfg.AccessLogMaxSize, cfg.AccessLogMaxBackups)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		accessLog = io.MultiWriter(os.Stdout, file)
+	}
+	// ログインの試行回数の制限などに使うクライアントのIPアドレスを決める
+	// X-Forwarded-Forはクライアントが自由に付けられるので、TRUSTED_PROXIESに指定したプロキシを経由したときだけ使う
+	if len(cfg.TrustedProxies) > 0 {
+		options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+		for _, network := range cfg.TrustedProxies {
+			options = append(options, echo.TrustIPRange(network))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(options...)
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	// リクエストごとにIDを発行してX-Request-IDレスポンスヘッダーで返す
+	// クライアントがX-Request-IDを付けて送ってきた場合はその値をそのまま使う
+	// アクセスログとハンドラーのログにも同じIDを記録するので、不具合の報告からログをたどれる
+	e.Use(middleware.RequestID())
+
+	// リクエストごとにID、メソッド、パス、ステータス、処理時間、クライアントのIPをJSONで1行ずつ記録する
+	// ヘルスチェック用の /ping は頻繁に呼ばれるので記録しない
+	accessLogger := slog.New(slog.NewJSONHandler(accessLog, nil))
+	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/ping"
+		},
+		LogRequestID: true,
+		LogMethod:    true,
+		LogURIPath:   true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogError:     true,
+		// エラーをここでレスポンスにしておかないと、記録するステータスが実際と異なってしまう
+		HandleError: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			attrs := []slog.Attr{
+				slog.String("request_id", v.RequestID),
+				slog.String("method", v.Method),
+				slog.String("path", v.URIPath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			accessLogger.LogAttrs(context.Background(), slog.LevelInfo, "request", attrs...)
+			return nil
+		},
+	}))
+
+	// ハンドラーがpanicしてもサーバーを止めず、JSONの500を返す
+	// アクセスログにも500として記録されるよう、ロガーの内側で回復する
+	e.Use(handler.RecoverMiddleware())
+
+	// CORS_ALLOWED_ORIGINSにカンマ区切りで指定したオリジンからのリクエストだけを許可する
+	// セッションのCookieを送れるようにAllowCredentialsを有効にしている
+	// 指定しない場合はCORSのヘッダーを返さず、ブラウザからのクロスオリジンのリクエストは全て拒否される
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins:     cfg.CORSAllowedOrigins,
+			AllowMethods:     []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPatch, http.MethodDelete},
+			AllowHeaders:     []string{echo.HeaderContentType, handler.CSRFHeader, "X-Response-Envelope", "X-Full-Representation"},
+			ExposeHeaders:    []string{"Retry-After", echo.HeaderXRequestID, "X-Total-Count", "Link", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
+			AllowCredentials: true,
+		}))
+	}
+
+	// リクエストボディの大きさを BODY_LIMIT (デフォルト1M) までに制限する
+	// 超えた場合は413 Request Entity Too Largeを他のエラーと同じJSONの形式で返す
+	e.Use(handler.BodyLimitMiddleware(cfg.BodyLimit))
+
 	e.Use(session.Middleware(store)) // セッション管理のためのミドルウェアを追加
 
+	// CSRF対策のミドルウェアを追加
+	// GETなどのリクエストで _csrf Cookieにトークンを発行し、POST/PATCH/DELETEではX-CSRF-Tokenヘッダーに同じトークンがあるかを確認する
+	// ログインとユーザー登録はまだトークンを持っていないクライアントも使うので確認しない
+	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		// Authorization: Bearer で認証するリクエストはCookieを使わないので確認しない
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/login" || c.Path() == "/signup" || handler.IsBearerRequest(c)
+		},
+		TokenLookup:    "header:" + handler.CSRFHeader,
+		CookieName:     "_csrf",
+		CookiePath:     "/",
+		CookieSameSite: http.SameSiteLaxMode,
+	}))
+
+	// レスポンスを圧縮するミドルウェアを追加
+	// COMPRESS_ALGORITHMSに優先順でカンマ区切りの圧縮方式を、COMPRESS_MIN_LENGTHに圧縮する最小バイト数を指定する
+	e.Use(handler.CompressMiddleware(handler.CompressConfig{
+		Algorithms: cfg.CompressAlgorithms,
+		MinLength:  cfg.CompressMinLength,
+	}))
+
+	// リクエストのタイムアウトを設定するミドルウェアを追加
+	// REQUEST_TIMEOUTに全体のタイムアウトを、REQUEST_TIMEOUT_OVERRIDESに "/cities/export=2m" の形式でルートごとのタイムアウトを指定する
+	e.Use(handler.TimeoutMiddleware(handler.TimeoutConfig{
+		Default:   cfg.RequestTimeout,
+		Overrides: cfg.RequestTimeoutOverrides,
+	}))
+
+	// RESPONSE_ENVELOPEがtrueなら、成功レスポンスを {"data": ..., "meta": ...} で包んで返す
+	e.Use(handler.EnvelopeMiddleware(cfg.ResponseEnvelope))
+
+	// STRICT_INPUT_CHECKがtrueなら、SQLのような文字列を含むパラメータを拒否する
+	// アポストロフィを含む正当な名前を拒否しないよう、デフォルトでは無効にしている
+	if cfg.StrictInputCheck {
+		e.Use(handler.SuspiciousInputMiddleware)
+	}
+
 	e.POST("/signup", h.SignUpHandler)
 	e.POST("/login", h.LoginHandler)
+	e.POST("/logout", handler.LogoutHandler)
 	e.GET("/ping", func(c echo.Context) error { return c.String(http.StatusOK, "pong") })
+	e.GET("/csrf", handler.GetCSRFTokenHandler)
+
+	// 参照するだけのAPIはログインしなくても使える
+	e.GET("/cities/:cityName", h.GetCityInfoHandler)
+	e.GET("/world/:countryName/:cityName", h.GetWorldHandler)
+	e.GET("/cities", h.GetCitiesHandler)
+	e.GET("/cities/count", h.GetCityCountHandler)
+	e.GET("/cities/export", h.GetCitiesExportHandler)
+	// 都市の取得だけなのでログインは不要。IDの配列をボディで受け取るためPOSTにしている
+	e.POST("/cities/batch", h.PostCitiesBatchHandler)
+	e.GET("/cities/recent", h.GetRecentCitiesHandler)
+	e.GET("/cities/by-magnitude", h.GetCitiesByMagnitudeHandler)
+	e.GET("/cities/index", h.GetCityIndexHandler)
+	e.GET("/cities/smallest", h.GetSmallestCityHandler)
+	e.GET("/cities/by-name-length", h.GetCitiesByNameLengthHandler)
+	e.GET("/cities/name-collisions", h.GetCityNameCollisionsHandler)
+	e.GET("/cities/regex", h.GetCitiesByRegexHandler)
+	e.GET("/cities/search", h.GetCitiesByNameHandler)
+	e.GET("/cities/autocomplete", h.GetCityAutocompleteHandler)
+	e.GET("/cities/:id/history", h.GetCityPopulationHistoryHandler)
+	e.GET("/cities/:id/nearby", h.GetNearbyCitiesHandler)
+	e.GET("/continents/average-population", h.GetContinentAveragePopulationHandler)
+	e.GET("/continents/:continent/cities", h.GetContinentCitiesHandler)
+	e.GET("/countries", h.GetCountriesHandler)
+	e.GET("/countries/most-cities", h.GetCountryWithMostCitiesHandler)
+	e.GET("/countries/search", h.GetCountrySearchHandler)
+	e.GET("/countries/:code", h.GetCountryHandler)
+	e.GET("/countries/:code/languages", h.GetCountryLanguagesHandler)
+	e.GET("/countries/:code/cities", h.GetCountryCitiesHandler)
+	e.GET("/countries/:code/continent-rank", h.GetCountryContinentRankHandler)
+	e.GET("/tree/cities", h.GetCityTreeHandler)
+	e.GET("/stats/countries", h.GetCountryStatsHandler)
+	e.GET("/stats/continents", h.GetContinentPopulationHandler)
+	e.GET("/stats/top-cities", h.GetTopCitiesHandler)
+	e.GET("/stats/richest-countries", h.GetRichestCountriesHandler)
 
+	// データを変更するAPIと、ログイン中のユーザー自身や管理用のAPIはログインが必要
+	// 管理用のAPIはさらに管理者であることが必要
+	// セッションの代わりに /me/token で発行したトークンを Authorization: Bearer ヘッダーで送ってもよい
 	withAuth := e.Group("")
-	withAuth.Use(handler.UserAuthMiddleware)
-	withAuth.GET("/me", handler.GetMeHandler)
-	withAuth.GET("/cities/:cityName", h.GetCityInfoHandler)
-	withAuth.GET("/world/:countryName/:cityName", h.GetWorldHandler)
+	withAuth.Use(h.AuthMiddleware)
+	withAuth.GET("/me", h.GetMeHandler)
+	withAuth.GET("/ws/cities", h.CitiesWebSocketHandler)
+	withAuth.POST("/me/password", h.ChangePasswordHandler)
+	withAuth.DELETE("/me", h.DeleteMeHandler)
+	withAuth.GET("/me/favorites", h.GetFavoritesHandler)
+	withAuth.POST("/me/favorites/:cityId", h.PostFavoriteHandler)
+	withAuth.DELETE("/me/favorites/:cityId", h.DeleteFavoriteHandler)
+	// TOKEN_SECRETが設定されているときだけトークンを発行できるようにする
+	// トークンでトークンを発行し直して有効期限を延ばせないよう、セッションでのログインを必要とする
+	if len(h.TokenSigningKey) > 0 {
+		e.GET("/me/token", h.GetMeTokenHandler, handler.UserAuthMiddleware)
+	}
 	withAuth.POST("/cities", h.PostCityHandler)
+	withAuth.POST("/cities/bulk", h.PostCitiesBulkHandler)
+	withAuth.POST("/cities/import", h.PostCitiesImportHandler)
+	withAuth.POST("/cities/validate", h.ValidateCitiesHandler)
+	withAuth.PATCH("/cities/:id", h.UpdateCityHandler)
+	withAuth.DELETE("/cities/:id", h.DeleteCityHandler)
+	withAuth.POST("/admin/scenario", h.PostScenarioHandler, h.AdminOnlyMiddleware)
+	withAuth.POST("/admin/cities/snapshots", h.PostCitySnapshotHandler, h.AdminOnlyMiddleware)
+	withAuth.GET("/admin/cities/diff", h.GetCitySnapshotDiffHandler, h.AdminOnlyMiddleware)
+	withAuth.POST("/admin/stats/refresh", h.PostStatsRefreshHandler, h.AdminOnlyMiddleware)
+	withAuth.GET("/admin/integrity", h.GetIntegrityHandler, h.AdminOnlyMiddleware)
+	withAuth.GET("/admin/cities/anomalies", h.GetCityAnomaliesHandler, h.AdminOnlyMiddleware)
+	withAuth.GET("/audit", h.GetAuditLogHandler, h.AdminOnlyMiddleware)
 
-	err = e.Start(":8080")
+	// サーバーは別のgoroutineで起動し、SIGINTかSIGTERMを受け取ったら処理中のリクエストを待ってから終了する
+	serverErr := make(chan error, 1)
+	go func() {
+		// TLS_AUTOCERT_DOMAINSが設定されていればHTTPSで、そうでなければ開発用にHTTPで待ち受ける
+		if len(cfg.TLSAutocertDomains) > 0 {
+			serverErr <- startAutoTLS(e, cfg)
+		} else {
+			serverErr <- e.Start(":8080")
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		stop()
+		slog.Info("shutting down server, waiting for in-flight requests", "timeout", shutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = e.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal(err)
-		log.Println("here")
+		slog.Error("failed to shut down server gracefully", "error", err)
+	} else {
+		slog.Info("server stopped")
+	}
+
+	err = db.Close()
+	if err != nil {
+		slog.Error("failed to close database", "error", err)
+	} else {
+		slog.Info("database connection closed")
 	}
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedSuffixFormat はローテーションしたファイル名に付ける日時の形式
+// 辞書順に並べると古い順になる
+const rotatedSuffixFormat = "20060102-150405.000"
+
+// rotatingFile はサイズが maxSize を超えそうになったらファイルをローテーションする io.Writer
+// ローテーションしたファイルは "<path>.<日時>" にリネームされ、新しいものから maxBackups 個だけ残す
+// maxBackups が0以下なら全て残す
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(r.path, r.path+"."+time.Now().Format(rotatedSuffixFormat))
+	if err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	err = r.open()
+	if err != nil {
+		return err
+	}
+
+	// 古いファイルを消せなくてもログの書き込みは続ける
+	err = r.prune()
+	if err != nil {
+		slog.Error("failed to prune rotated log files", "error", err)
+	}
+	return nil
+}
+
+// prune はローテーションしたファイルのうち、新しいものから maxBackups 個を残して削除する
+func (r *rotatingFile) prune() error {
+	if r.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > r.maxBackups {
+		err = os.Remove(backups[0])
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove rotated log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backups はローテーションしたファイルのパスを古い順に返す
+// 同じディレクトリにある "<path>.<日時>" の形のファイルだけを対象にする
+func (r *rotatingFile) backups() ([]string, error) {
+	dir, base := filepath.Split(r.path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log directory: %w", err)
+	}
+	backups := []string{}
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), base+".")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(rotatedSuffixFormat, suffix); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileWritesToPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r, err := newRotatingFile(path, 1024, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first\nsecond\n" {
+		t.Fatalf("file content = %q, want %q", b, "first\nsecond\n")
+	}
+}
+
+func TestRotatingFileRotatesAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	r, err := newRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 10バイトちょうどまではローテーションしない
+	if _, err := r.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if got := rotatedFiles(t, dir); len(got) != 0 {
+		t.Fatalf("rotated before reaching max size: %v", got)
+	}
+
+	// 超える書き込みの前に古いファイルを日時付きの名前で残し、新しいファイルに書く
+	if _, err := r.Write([]byte("next\n")); err != nil {
+		t.Fatal(err)
+	}
+	rotated := rotatedFiles(t, dir)
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files = %v, want 1", rotated)
+	}
+	if !regexp.MustCompile(`^access\.log\.\d{8}-\d{6}\.\d{3}$`).MatchString(rotated[0]) {
+		t.Errorf("rotated file name %q does not have a timestamp suffix", rotated[0])
+	}
+
+	old, err := os.ReadFile(filepath.Join(dir, rotated[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "0123456789" {
+		t.Errorf("rotated file content = %q, want %q", old, "0123456789")
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "next\n" {
+		t.Errorf("current file content = %q, want %q", current, "next\n")
+	}
+}
+
+func TestRotatingFileCountsExistingSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	err := os.WriteFile(path, []byte("existing\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 既存の9バイトと合わせて上限を超えるので、書き込む前にローテーションする
+	if _, err := r.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := rotatedFiles(t, dir); len(got) != 1 {
+		t.Fatalf("rotated files = %v, want 1", got)
+	}
+}
+
+func TestRotatingFileWritesOversizedLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	r, err := newRotatingFile(path, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 空のファイルには上限を超える1行でもローテーションせずに書き込む
+	if _, err := r.Write([]byte("a long line\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := rotatedFiles(t, dir); len(got) != 0 {
+		t.Fatalf("rotated an empty file: %v", got)
+	}
+}
+
+// rotatedFiles は dir にあるローテーション済みのファイル名を返す
+func rotatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Name() != "access.log" {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestRotatingFileKeepsMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	// 前回の起動で残ったローテーション済みのファイルと、関係のないファイル
+	for _, name := range []string{"access.log.20240101-000000.000", "access.log.20240102-000000.000", "access.log.old", "other.log.20240101-000000.000"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := newRotatingFile(path, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Write([]byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+		// ファイル名の日時はミリ秒単位なので、同じ名前にならないよう間を空ける
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+	for _, backup := range backups {
+		if strings.HasPrefix(filepath.Base(backup), "access.log.2024") {
+			t.Errorf("oldest backup %s was not removed", backup)
+		}
+	}
+
+	// 形式の違うファイルや別のログのファイルは消さない
+	for _, name := range []string{"access.log.old", "other.log.20240101-000000.000"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+}
+
+func TestRotatingFileKeepsAllBackupsWhenUnlimited(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	r, err := newRotatingFile(path, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := r.Write([]byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if got := rotatedFiles(t, dir); len(got) != 3 {
+		t.Fatalf("rotated files = %v, want 3", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ensureColumn は table に column が存在しなければ、definition で追加する
+// MySQLは ADD COLUMN IF NOT EXISTS に対応していないので information_schema で確認する
+// カラムを追加したときは true を返す
+func ensureColumn(db *sqlx.DB, table string, column string, definition string) (bool, error) {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column)
+	if err != nil {
+		return false, fmt.Errorf("failed to check column %s.%s: %w", table, column, err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return false, fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	slog.Info("added column", "table", table, "column", column)
+	return true, nil
+}
+
+// ensureColumnCollation は table の column の照合順序が collation でなければ、definition と collation で変更する
+// 既存の値が新しい照合順序で重複する場合は変更に失敗するので、エラーを返す
+func ensureColumnCollation(db *sqlx.DB, table string, column string, definition string, collation string) error {
+	var current string
+	err := db.Get(&current, "SELECT COALESCE(COLLATION_NAME, '') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", table, column)
+	if err != nil {
+		return fmt.Errorf("failed to check collation of %s.%s: %w", table, column, err)
+	}
+	if current == collation {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY %s %s COLLATE %s", table, column, definition, collation))
+	if err != nil {
+		return fmt.Errorf("failed to change collation of %s.%s from %s to %s: %w", table, column, current, collation, err)
+	}
+	slog.Warn("changed collation", "table", table, "column", column, "from", current, "to", collation)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/traPtitech/naro-template-backend/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// startAutoTLS はLet's Encryptで証明書を取得してHTTPSで待ち受ける
+// HTTP-01チャレンジのために80番ポートも使うので、80番と443番の両方をbindできる必要がある
+// 80番ポートへのチャレンジ以外のリクエストはHTTPSにリダイレクトされる
+// e.Shutdown で両方のサーバーを止められるように、e.TLSServer と e.Server を使う
+// TLSの最小バージョンと暗号スイートは cfg の TLSMinVersion と TLSCipherSuites を使う
+func startAutoTLS(e *echo.Echo, cfg config.Config) error {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+		Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+	}
+
+	e.Server.Addr = ":80"
+	e.Server.Handler = m.HTTPHandler(nil)
+	go func() {
+		err := e.Server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	e.TLSServer.Addr = ":443"
+	tlsConfig := m.TLSConfig()
+	tlsConfig.MinVersion = cfg.TLSMinVersion
+	tlsConfig.CipherSuites = cfg.TLSCipherSuites
+	e.TLSServer.TLSConfig = tlsConfig
+	return e.TLSServer.ListenAndServeTLS("", "")
+}